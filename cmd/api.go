@@ -0,0 +1,140 @@
+package cmd
+
+import (
+    "encoding/json"
+    "errors"
+    "io"
+    "log/slog"
+    "net/http"
+    "os"
+    "sync/atomic"
+
+    "devopsmate/pkg"
+    "golang.org/x/crypto/ssh"
+)
+
+// createInstanceRequest is the body accepted by POST /instances
+type createInstanceRequest struct {
+    APIKey string `json:"apiKey"`
+    Region string `json:"region"`
+    // SSHKey is an unencrypted private key in PEM or OpenSSH format used to
+    // log in to the instance. It is never read as a path on the server.
+    SSHKey string `json:"sshKey"`
+    // SSHKeyID is the Civo SSH key to install on the instance, matching SSHKey
+    SSHKeyID   string   `json:"sshKeyId"`
+    Installers []string `json:"installers"`
+}
+
+// errorResponse is the body returned for failed API requests
+type errorResponse struct {
+    Error string `json:"error"`
+    // Installer names the installer that failed, if any
+    Installer string `json:"installer,omitempty"`
+}
+
+// maxRequestBody is the largest request body the API reads, ample for an
+// API key and a private key
+const maxRequestBody = 1 << 20
+
+// activeJobs counts the provisioning requests currently being handled
+var activeJobs atomic.Int64
+
+// instancesHandler provisions an instance synchronously and returns its details
+func instancesHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+        return
+    }
+
+    var req createInstanceRequest
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&req); err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "request body too large"})
+            return
+        }
+        writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid JSON body: " + err.Error()})
+        return
+    }
+    if req.APIKey == "" {
+        writeJSON(w, http.StatusBadRequest, errorResponse{Error: "apiKey is required"})
+        return
+    }
+    if req.SSHKeyID != "" && req.SSHKey == "" {
+        writeJSON(w, http.StatusBadRequest, errorResponse{Error: "sshKeyId needs the matching private key in sshKey"})
+        return
+    }
+
+    var keyPath string
+    if req.SSHKey != "" {
+        if _, err := ssh.ParsePrivateKey([]byte(req.SSHKey)); err != nil {
+            writeJSON(w, http.StatusBadRequest, errorResponse{Error: "sshKey must be an unencrypted private key: " + err.Error()})
+            return
+        }
+        path, err := writeTempKey(req.SSHKey)
+        if err != nil {
+            slog.Error("writing SSH key failed", "err", err)
+            writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "error storing sshKey"})
+            return
+        }
+        defer os.Remove(path)
+        keyPath = path
+    }
+
+    activeJobs.Add(1)
+    defer activeJobs.Add(-1)
+
+    // Provisioning runs under the request context, so a client that
+    // disconnects cancels it and the half-built instance is deleted rather
+    // than left running with nobody to receive its details.
+    details, err := pkg.CreateComputeInstanceContext(r.Context(), req.APIKey, req.Region, keyPath, pkg.InstanceOptions{
+        Installers: req.Installers,
+        Configured: configuredInstallers,
+        SSHKeyID:   req.SSHKeyID,
+        Output:     io.Discard,
+    })
+    if err != nil {
+        slog.Error("provisioning failed", "err", err)
+        status, resp := provisioningError(err)
+        writeJSON(w, status, resp)
+        return
+    }
+    writeJSON(w, http.StatusCreated, details)
+}
+
+// writeTempKey writes a private key to a file only the current user can
+// read and returns its path. The caller removes it.
+func writeTempKey(key string) (string, error) {
+    f, err := os.CreateTemp("", "devopsmate-key-*")
+    if err != nil {
+        return "", err
+    }
+    if _, err := f.WriteString(key); err != nil {
+        f.Close()
+        os.Remove(f.Name())
+        return "", err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(f.Name())
+        return "", err
+    }
+    return f.Name(), nil
+}
+
+// provisioningError maps a provisioning failure to an HTTP status and body
+func provisioningError(err error) (int, errorResponse) {
+    resp := errorResponse{Error: err.Error()}
+    var installerErr *pkg.InstallerError
+    switch {
+    case errors.Is(err, pkg.ErrAuth):
+        return http.StatusUnauthorized, resp
+    case errors.Is(err, pkg.ErrInstanceTimeout):
+        return http.StatusGatewayTimeout, resp
+    case errors.Is(err, pkg.ErrSSHUnreachable):
+        return http.StatusBadGateway, resp
+    case errors.As(err, &installerErr):
+        resp.Installer = installerErr.Name
+    }
+    return http.StatusInternalServerError, resp
+}
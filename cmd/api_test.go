@@ -0,0 +1,17 @@
+package cmd
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestInstancesHandlerBodyLimit(t *testing.T) {
+    body := `{"apiKey": "` + strings.Repeat("x", maxRequestBody) + `"}`
+    rec := httptest.NewRecorder()
+    instancesHandler(rec, httptest.NewRequest(http.MethodPost, "/instances", strings.NewReader(body)))
+    if rec.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("got status %d, want %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body)
+    }
+}
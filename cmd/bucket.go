@@ -0,0 +1,59 @@
+package cmd
+
+import (
+    "errors"
+    "fmt"
+    "log/slog"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+var (
+    bucketAPIKey string
+    bucketRegion string
+    bucketName   string
+    bucketExport string
+)
+
+// bucketCmd creates an object store bucket
+var bucketCmd = &cobra.Command{
+    Use:   "bucket",
+    Short: "Create a Civo object store bucket and print its credentials",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        apiKey, err := resolveAPIKey(bucketAPIKey)
+        if err != nil {
+            return err
+        }
+
+        store, err := pkg.CreateObjectStore(cmd.Context(), apiKey, bucketRegion, bucketName)
+        if store.ID != "" && bucketExport != "" {
+            if exportErr := pkg.WriteInventory(bucketExport, pkg.NewObjectStoreInventory(store)); exportErr != nil {
+                err = errors.Join(err, exportErr)
+            } else {
+                slog.Info("inventory written", "path", bucketExport)
+            }
+        }
+        if err != nil {
+            if store.ID != "" {
+                return fmt.Errorf("%w (object store ID %s)", err, store.ID)
+            }
+            return err
+        }
+        fmt.Printf("ID:         %s\n", store.ID)
+        fmt.Printf("Endpoint:   %s\n", store.Endpoint)
+        fmt.Printf("Access key: %s\n", store.AccessKey)
+        fmt.Printf("Secret key: %s\n", store.SecretKey)
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(bucketCmd)
+
+    bucketCmd.Flags().StringVar(&bucketAPIKey, "api-key", "", "Civo API key (defaults to $CIVO_API_KEY)")
+    bucketCmd.Flags().StringVar(&bucketRegion, "region", pkg.DefaultRegion, "Civo region code")
+    bucketCmd.Flags().StringVar(&bucketName, "name", "", "Name of the bucket")
+    bucketCmd.Flags().StringVar(&bucketExport, "export", "", "Write an inventory of the bucket to this YAML file (JSON if it ends in .json), for destroy --from")
+    bucketCmd.MarkFlagRequired("name")
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+    "os"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+// completionCmd prints shell completion scripts
+var completionCmd = &cobra.Command{
+    Use:   "completion bash|zsh|fish|powershell",
+    Short: "Generate a shell completion script",
+    Long: `Generate a script that adds tab completion of devopsmate commands and flags
+to your shell.
+
+Bash (requires the bash-completion package):
+  Current session:  source <(devopsmate completion bash)
+  Every session:    devopsmate completion bash | sudo tee /etc/bash_completion.d/devopsmate > /dev/null
+  On macOS:         devopsmate completion bash > $(brew --prefix)/etc/bash_completion.d/devopsmate
+
+Zsh:
+  If completion is not enabled yet, run once:  echo "autoload -U compinit; compinit" >> ~/.zshrc
+  Every session:    devopsmate completion zsh > "${fpath[1]}/_devopsmate"
+  Then start a new shell.
+
+Fish:
+  Current session:  devopsmate completion fish | source
+  Every session:    devopsmate completion fish > ~/.config/fish/completions/devopsmate.fish
+
+PowerShell:
+  Current session:  devopsmate completion powershell | Out-String | Invoke-Expression
+  Every session:    add the line above to your PowerShell profile.`,
+    Args:                  cobra.ExactArgs(1),
+    ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+    DisableFlagsInUseLine: true,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if err := cobra.OnlyValidArgs(cmd, args); err != nil {
+            return err
+        }
+        switch args[0] {
+        case "bash":
+            return rootCmd.GenBashCompletionV2(os.Stdout, true)
+        case "zsh":
+            return rootCmd.GenZshCompletion(os.Stdout)
+        case "fish":
+            return rootCmd.GenFishCompletion(os.Stdout, true)
+        default:
+            return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+        }
+    },
+}
+
+func init() {
+    rootCmd.CompletionOptions.DisableDefaultCmd = true
+    rootCmd.AddCommand(completionCmd)
+
+    uninstallCmd.ValidArgsFunction = completeInstallers
+    createCmd.RegisterFlagCompletionFunc("installers", completeInstallerSelection)
+    installCmd.RegisterFlagCompletionFunc("installers", completeInstallers)
+    planCmd.RegisterFlagCompletionFunc("installers", completeInstallerSelection)
+}
+
+// completeInstallers suggests the names of the registered installers
+func completeInstallers(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+    return pkg.RegisteredInstallers(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeInstallerSelection suggests all, none and the registered installers
+func completeInstallerSelection(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+    return append([]string{"all", "none"}, pkg.RegisteredInstallers()...), cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,411 @@
+package cmd
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "os/signal"
+    "slices"
+    "sort"
+    "strings"
+    "syscall"
+    "text/tabwriter"
+    "time"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+var (
+    createAPIKey      string
+    createRegion      string
+    createFallbacks   []string
+    createSSHKey      string
+    createKnownHosts  string
+    createHomeDir     string
+    createWorkDir     string
+    createSSHTimeout  time.Duration
+    createSSHPort     int
+    createSSHKeyID    string
+    createTemplate    string
+    createTags        []string
+    createSize        string
+    createInstallers  []string
+    createAptPackages []string
+    createStartup     string
+    createFirewallID  string
+    createAllowPorts  []int
+    createAllowCIDRs  []string
+    createOpenJenkins bool
+    createEnv         map[string]string
+    createResume      string
+    createExport      string
+    createWait        bool
+    createNoWait      bool
+
+    createInstallerTimeout  time.Duration
+    createVerifyTimeout     time.Duration
+    createContinueOnTimeout bool
+    createContinueOnError   bool
+
+    createOutputFormat string
+    createKeepOnCancel bool
+)
+
+// createCmd provisions an instance and installs software on it
+var createCmd = &cobra.Command{
+    Use:   "create",
+    Short: "Create a Civo compute instance and install DevOps tooling on it",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        apiKey, err := resolveAPIKey(createAPIKey)
+        if err != nil {
+            return err
+        }
+        if createOutputFormat != "text" && createOutputFormat != "json" {
+            return fmt.Errorf("invalid --output %q: must be text or json", createOutputFormat)
+        }
+
+        if createOpenJenkins && len(createAllowPorts) == 0 {
+            return errors.New("--open-jenkins-port only applies to the firewall created by --allow-port")
+        }
+
+        if createSSHKeyID != "" && createSSHKey == "" {
+            return errors.New("--ssh-key-id needs the matching private key in --ssh-key to log in")
+        }
+
+        installers, skipInstallers, err := parseInstallers(createInstallers)
+        if err != nil {
+            return err
+        }
+        configured, err := withAptPackages(configuredInstallers, createAptPackages, installers)
+        if err != nil {
+            return err
+        }
+        noWait := createNoWait || !createWait
+        if noWait && createResume != "" {
+            return errors.New("--no-wait cannot be combined with --resume")
+        }
+        if noWait && cmd.Flags().Changed("installers") && !skipInstallers {
+            return errors.New("--no-wait cannot run installers; drop --installers or use --installers none")
+        }
+
+        var startupScript string
+        if createStartup != "" {
+            script, err := os.ReadFile(createStartup)
+            if err != nil {
+                return fmt.Errorf("error reading startup script: %w", err)
+            }
+            startupScript = string(script)
+        }
+
+        // Keep stdout clean for the JSON document by streaming installer
+        // output to stderr instead.
+        var output io.Writer
+        if createOutputFormat == "json" {
+            output = os.Stderr
+        }
+
+        ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+        defer stop()
+
+        opts := pkg.InstanceOptions{
+            Size:              createSize,
+            Installers:        installers,
+            Configured:        configured,
+            SkipInstallers:    skipInstallers,
+            FallbackRegions:   createFallbacks,
+            NoWait:            noWait,
+            Env:               createEnv,
+            StartupScript:     startupScript,
+            SSHKeyPassphrase:  os.Getenv(sshKeyPassphraseEnv),
+            KnownHostsFile:    createKnownHosts,
+            SudoPassword:      os.Getenv(sudoPasswordEnv),
+            HomeDir:           createHomeDir,
+            WorkDir:           createWorkDir,
+            SSHPort:           createSSHPort,
+            SSHConnectTimeout: createSSHTimeout,
+            SSHKeyID:          createSSHKeyID,
+            Template:          createTemplate,
+            Tags:              createTags,
+            FirewallID:        createFirewallID,
+            FirewallRules:     firewallRules(createAllowPorts, createAllowCIDRs),
+            OpenJenkinsPort:   createOpenJenkins,
+            InstallerTimeout:  createInstallerTimeout,
+            VerifyTimeout:     createVerifyTimeout,
+            ContinueOnTimeout: createContinueOnTimeout,
+            ContinueOnError:   createContinueOnError,
+            Output:            output,
+            KeepOnCancel:      createKeepOnCancel,
+        }
+
+        var state runState
+        var details pkg.InstanceDetails
+        if createResume != "" {
+            if state, err = loadRunState(createResume); err != nil {
+                return err
+            }
+            opts.Installers = state.Installers
+            opts.Completed = state.Completed
+            slog.Info("resuming run", "run", state.RunID, "id", state.InstanceID, "completed", state.Completed)
+            details, err = pkg.ResumeComputeInstance(ctx, apiKey, state.Region, createSSHKey, state.InstanceID, opts)
+        } else {
+            runID, idErr := newRunID()
+            if idErr != nil {
+                return idErr
+            }
+            state = runState{RunID: runID, Region: createRegion, Installers: installers}
+            details, err = pkg.CreateComputeInstanceContext(ctx, apiKey, createRegion, createSSHKey, opts)
+        }
+        recordRun(ctx, state, details, err)
+        if exportErr := exportInventory(ctx, details); exportErr != nil {
+            err = errors.Join(err, exportErr)
+        }
+
+        if createOutputFormat == "json" {
+            if jsonErr := printJSONSummary(details, err); jsonErr != nil {
+                return jsonErr
+            }
+            return err
+        }
+        if noWait && err == nil {
+            fmt.Printf("Instance %s (%s) is being created in %s\n", details.ID, details.Name, details.Region)
+            fmt.Printf("Follow it with: devopsmate status --region %s --id %s --watch\n", details.Region, details.ID)
+            return nil
+        }
+        printInstanceDetails(details)
+        printInstallResults(details.Results)
+        return err
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(createCmd)
+
+    createCmd.Flags().StringVar(&createAPIKey, "api-key", "", "Civo API key (defaults to $CIVO_API_KEY)")
+    createCmd.Flags().StringVar(&createRegion, "region", pkg.DefaultRegion, "Civo region code")
+    createCmd.Flags().StringSliceVar(&createFallbacks, "fallback-region", nil, "Regions to try in order if --region is out of capacity")
+    createCmd.Flags().StringVar(&createSSHKey, "ssh-key", "", "Path to the SSH private key used to reach the instance (set $DEVOPSMATE_SSH_KEY_PASSPHRASE if it is encrypted). Without one, the password Civo generates is used")
+    createCmd.Flags().StringVar(&createSize, "size", "", "Civo instance size, e.g. g3.medium (defaults to Civo's default)")
+    createCmd.Flags().StringSliceVar(&createInstallers, "installers", nil, "Installers to run: all, none or a list of names (defaults to jenkins,sonarqube,buildpack,kubernetes)")
+    createCmd.Flags().StringSliceVar(&createAptPackages, "apt-packages", nil, "Packages for the apt-packages installer to install, e.g. git,jq")
+    createCmd.Flags().StringToStringVar(&createEnv, "env", nil, "Environment variables for the installers, e.g. HTTPS_PROXY=http://proxy:3128")
+    createCmd.Flags().StringVar(&createStartup, "startup-script", "", "File with a script or cloud-init config run when the instance first boots")
+    createCmd.Flags().StringVar(&createSSHKeyID, "ssh-key-id", "", "ID of the Civo SSH key to install on the instance (see the ssh-key command)")
+    createCmd.Flags().StringSliceVar(&createTags, "tag", nil, "Extra tags for the instance; \"devopsmate\" is always added")
+    createCmd.Flags().StringVar(&createTemplate, "template", "", "Disk image name or ID, e.g. ubuntu-jammy (defaults to the latest Ubuntu)")
+    createCmd.Flags().StringVar(&createFirewallID, "firewall-id", "", "ID of an existing Civo firewall to attach")
+    createCmd.Flags().IntSliceVar(&createAllowPorts, "allow-port", nil, "Create a firewall allowing only these inbound TCP ports, e.g. 22,8080")
+    createCmd.Flags().StringSliceVar(&createAllowCIDRs, "allow-cidr", nil, "Source networks allowed by --allow-port (defaults to anywhere)")
+    createCmd.Flags().BoolVar(&createOpenJenkins, "open-jenkins-port", false, "Also allow port 8080 through the --allow-port firewall when installing Jenkins")
+    createCmd.Flags().IntVar(&createSSHPort, "ssh-port", pkg.DefaultSSHPort, "Port sshd listens on, if the image or startup script moves it")
+    createCmd.Flags().DurationVar(&createSSHTimeout, "ssh-connect-timeout", pkg.DefaultSSHConnectTimeout, "Give up on an SSH connection attempt after this long")
+    createCmd.Flags().StringVar(&createKnownHosts, "known-hosts", "", "Verify the instance host key against this known_hosts file (recommended)")
+    createCmd.Flags().StringVar(&createHomeDir, "home-dir", "", "Home directory of the SSH user, if not the login default")
+    createCmd.Flags().StringVar(&createWorkDir, "workdir", "", "Directory to run remote commands in")
+    createCmd.Flags().DurationVar(&createInstallerTimeout, "installer-timeout", 0, "Maximum time each installer may take (0 for no limit)")
+    createCmd.Flags().DurationVar(&createVerifyTimeout, "verify-timeout", pkg.DefaultVerifyTimeout, "How long to keep checking that installed software has started")
+    createCmd.Flags().BoolVar(&createContinueOnTimeout, "continue-on-timeout", false, "Skip an installer that exceeds --installer-timeout, and its dependents, instead of aborting")
+    createCmd.Flags().BoolVar(&createKeepOnCancel, "keep-on-cancel", false, "Keep the instance if the run is interrupted instead of deleting it")
+    createCmd.Flags().StringVarP(&createOutputFormat, "output", "o", "text", "Output format: text or json")
+    createCmd.Flags().BoolVar(&createWait, "wait", true, "Wait for the instance to become active and run the installers")
+    createCmd.Flags().BoolVar(&createNoWait, "no-wait", false, "Return as soon as the instance is accepted, without waiting for it or running installers")
+    createCmd.MarkFlagsMutuallyExclusive("wait", "no-wait")
+    createCmd.Flags().StringVar(&createExport, "export", "", "Write an inventory of the created resources to this YAML file (JSON if it ends in .json), for destroy --from")
+    createCmd.Flags().StringVar(&createResume, "resume", "", "Resume a failed run by its ID, reusing its instance and skipping installers that succeeded")
+    createCmd.Flags().BoolVar(&createContinueOnError, "continue-on-error", false, "Keep installing after a failure and report every failed installer at the end")
+}
+
+// recordRun saves the state of a failed run that left an instance behind so
+// it can be resumed, and forgets the state of a run that succeeded
+func recordRun(ctx context.Context, state runState, details pkg.InstanceDetails, err error) {
+    if err == nil {
+        if rmErr := state.remove(); rmErr != nil {
+            slog.Warn("could not remove run state", "run", state.RunID, "err", rmErr)
+        }
+        return
+    }
+    if !instanceLeft(ctx, details) {
+        return
+    }
+
+    state.InstanceID = details.ID
+    if details.Region != "" {
+        state.Region = details.Region
+    }
+    if saveErr := state.save(details.Results); saveErr != nil {
+        slog.Warn("could not save run state", "run", state.RunID, "err", saveErr)
+        return
+    }
+    resume := "devopsmate create --resume " + state.RunID
+    if createSSHKey != "" {
+        resume += " --ssh-key " + createSSHKey
+    }
+    fmt.Fprintf(os.Stderr, "Run %s failed; fix the problem and resume it with: %s\n", state.RunID, resume)
+}
+
+// instanceLeft reports whether the run left an instance behind. A cancelled
+// run deletes the instance it created unless --keep-on-cancel is set; a
+// resumed run never deletes its instance.
+func instanceLeft(ctx context.Context, details pkg.InstanceDetails) bool {
+    deleted := errors.Is(ctx.Err(), context.Canceled) && !createKeepOnCancel && createResume == ""
+    return details.ID != "" && !deleted
+}
+
+// exportInventory writes the inventory of the created resources to --export,
+// if set. Nothing is written when no instance is left, such as in a dry run or
+// after a cancelled run deleted its instance.
+func exportInventory(ctx context.Context, details pkg.InstanceDetails) error {
+    if createExport == "" {
+        return nil
+    }
+    if !instanceLeft(ctx, details) {
+        slog.Warn("no instance was left behind, not writing inventory", "path", createExport)
+        return nil
+    }
+    if err := pkg.WriteInventory(createExport, pkg.NewInventory(details)); err != nil {
+        return err
+    }
+    slog.Info("inventory written", "path", createExport)
+    return nil
+}
+
+// parseInstallers interprets --installers. "all" selects every registered
+// installer, "none" skips installing, and anything else must be a list of
+// registered names. No value selects the default set. It reports whether to
+// skip installing.
+func parseInstallers(values []string) ([]string, bool, error) {
+    if len(values) == 1 {
+        switch strings.ToLower(strings.TrimSpace(values[0])) {
+        case "all":
+            return pkg.RegisteredInstallers(), false, nil
+        case "none":
+            return nil, true, nil
+        }
+    }
+
+    var names, unknown []string
+    for _, value := range values {
+        name := strings.TrimSpace(value)
+        if name == "" {
+            continue
+        }
+        if lower := strings.ToLower(name); lower == "all" || lower == "none" {
+            return nil, false, fmt.Errorf("invalid --installers: %q cannot be combined with other names", name)
+        }
+        if _, ok := pkg.LookupInstaller(name); !ok {
+            unknown = append(unknown, name)
+        }
+        names = append(names, name)
+    }
+    if len(unknown) > 0 {
+        return nil, false, fmt.Errorf("invalid --installers: unknown %s; use all, none or any of: %s",
+            strings.Join(unknown, ", "), strings.Join(pkg.RegisteredInstallers(), ", "))
+    }
+    return names, false, nil
+}
+
+// withAptPackages returns configured with an apt-packages installer for the
+// --apt-packages flag added, replacing any from --installer-config. The flag
+// only takes effect if apt-packages is among the selected installers.
+func withAptPackages(configured []pkg.SoftwareInstaller, packages, installers []string) ([]pkg.SoftwareInstaller, error) {
+    if len(packages) == 0 {
+        return configured, nil
+    }
+    if !slices.Contains(installers, "apt-packages") {
+        return nil, errors.New("--apt-packages needs apt-packages in --installers")
+    }
+    result := make([]pkg.SoftwareInstaller, 0, len(configured)+1)
+    for _, installer := range configured {
+        if installer.Name() != "apt-packages" {
+            result = append(result, installer)
+        }
+    }
+    return append(result, pkg.AptPackagesInstaller{Packages: packages}), nil
+}
+
+// firewallRules builds a TCP rule per port, each allowing the given networks
+func firewallRules(ports []int, cidrs []string) []pkg.FirewallRule {
+    rules := make([]pkg.FirewallRule, 0, len(ports))
+    for _, port := range ports {
+        rules = append(rules, pkg.FirewallRule{Protocol: "tcp", StartPort: port, CIDRs: cidrs})
+    }
+    return rules
+}
+
+// runSummary is the JSON document printed by create --output json
+type runSummary struct {
+    pkg.InstanceDetails
+    Error string `json:"error,omitempty"`
+}
+
+// printJSONSummary writes the instance details, install results and any
+// error of a create run to stdout as JSON
+func printJSONSummary(details pkg.InstanceDetails, runErr error) error {
+    summary := runSummary{InstanceDetails: details}
+    if runErr != nil {
+        summary.Error = runErr.Error()
+    }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(summary)
+}
+
+// printInstanceDetails renders the result of a create for humans
+func printInstanceDetails(details pkg.InstanceDetails) {
+    if details.ID != "" && details.PublicIP == "" {
+        fmt.Printf("Instance %s (%s) was created but is not ready\n", details.ID, details.Name)
+        return
+    }
+    if details.PublicIP == "" {
+        return
+    }
+
+    fmt.Println("Instance created successfully")
+    fmt.Printf("ID:        %s\n", details.ID)
+    fmt.Printf("Name:      %s\n", details.Name)
+    fmt.Printf("Region:    %s\n", details.Region)
+    fmt.Printf("Public IP: %s\n", details.PublicIP)
+    fmt.Printf("Password:  %s\n", details.Password)
+    fmt.Printf("SSH key:   %s\n", details.SSHKey)
+
+    keys := make([]string, 0, len(details.Outputs))
+    for key := range details.Outputs {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        value := details.Outputs[key]
+        if strings.Contains(strings.TrimSpace(value), "\n") {
+            fmt.Printf("%s:\n%s\n", key, value)
+        } else {
+            fmt.Printf("%s: %s\n", key, value)
+        }
+    }
+}
+
+// printInstallResults renders a summary table of the installers that ran
+func printInstallResults(results []pkg.InstallResult) {
+    if len(results) == 0 {
+        return
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "INSTALLER\tSTATUS\tDURATION\tERROR")
+    for _, r := range results {
+        status := "ok"
+        switch {
+        case !r.Success && r.Skipped:
+            status = "skipped"
+        case !r.Success:
+            status = "failed"
+        case r.Skipped:
+            status = "present"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Installer, status, r.Duration.Round(time.Second), r.Error)
+    }
+    w.Flush()
+}
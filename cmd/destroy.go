@@ -0,0 +1,129 @@
+package cmd
+
+import (
+    "fmt"
+    "log/slog"
+    "os"
+    "text/tabwriter"
+    "time"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+var (
+    destroyAPIKey  string
+    destroyRegion  string
+    destroyID      string
+    destroyWait    bool
+    destroyTimeout time.Duration
+    destroyTag     string
+    destroyDryRun  bool
+    destroyFrom    string
+)
+
+// destroyCmd deletes an instance created by DevOpsMate
+var destroyCmd = &cobra.Command{
+    Use:   "destroy",
+    Short: "Destroy a Civo compute instance",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        apiKey, err := resolveAPIKey(destroyAPIKey)
+        if err != nil {
+            return err
+        }
+
+        if destroyTag != "" {
+            return destroyTagged(apiKey)
+        }
+        if destroyFrom != "" {
+            return destroyInventory(apiKey)
+        }
+        if destroyDryRun {
+            fmt.Printf("Would destroy instance %s\n", destroyID)
+            return nil
+        }
+
+        if destroyWait {
+            err = pkg.DestroyComputeInstanceAndWait(apiKey, destroyRegion, destroyID, destroyTimeout)
+        } else {
+            err = pkg.DestroyComputeInstance(apiKey, destroyRegion, destroyID)
+        }
+        if err != nil {
+            return err
+        }
+
+        slog.Info("instance destroyed", "id", destroyID)
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(destroyCmd)
+
+    destroyCmd.Flags().StringVar(&destroyAPIKey, "api-key", "", "Civo API key (defaults to $CIVO_API_KEY)")
+    destroyCmd.Flags().StringVar(&destroyRegion, "region", pkg.DefaultRegion, "Civo region code")
+    destroyCmd.Flags().StringVar(&destroyID, "id", "", "ID of the instance to destroy")
+    destroyCmd.Flags().BoolVar(&destroyWait, "wait", false, "Wait until the instance is gone")
+    destroyCmd.Flags().DurationVar(&destroyTimeout, "timeout", pkg.DefaultTimeout, "How long to wait for the instance to be deleted")
+    destroyCmd.Flags().StringVar(&destroyTag, "tag", "", "Destroy every instance with this tag instead of one by ID, e.g. "+pkg.DefaultTag)
+    destroyCmd.Flags().BoolVar(&destroyDryRun, "dry-run", false, "Print the instances that would be destroyed without destroying them")
+    destroyCmd.Flags().StringVar(&destroyFrom, "from", "", "Destroy everything listed in an inventory written by create or bucket --export")
+    destroyCmd.MarkFlagsOneRequired("id", "tag", "from")
+    destroyCmd.MarkFlagsMutuallyExclusive("id", "tag", "from")
+    destroyCmd.MarkFlagsMutuallyExclusive("tag", "wait")
+    destroyCmd.MarkFlagsMutuallyExclusive("from", "wait")
+}
+
+// destroyInventory destroys, or with --dry-run lists, the resources in --from.
+// The region comes from the inventory.
+func destroyInventory(apiKey string) error {
+    inv, err := pkg.ReadInventory(destroyFrom)
+    if err != nil {
+        return err
+    }
+    if destroyDryRun {
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "WOULD DESTROY\tID")
+        if inv.KubernetesCluster != "" {
+            fmt.Fprintf(w, "kubernetes cluster\t%s\n", inv.KubernetesCluster)
+        }
+        if inv.InstanceID != "" {
+            fmt.Fprintf(w, "instance\t%s\n", inv.InstanceID)
+        }
+        if inv.FirewallID != "" {
+            fmt.Fprintf(w, "firewall\t%s\n", inv.FirewallID)
+        }
+        for _, store := range inv.ObjectStores {
+            fmt.Fprintf(w, "object store\t%s\n", store.ID)
+        }
+        return w.Flush()
+    }
+    return pkg.DestroyInventory(apiKey, inv, destroyTimeout)
+}
+
+// destroyTagged destroys, or with --dry-run lists, the instances with --tag
+func destroyTagged(apiKey string) error {
+    if destroyDryRun {
+        instances, err := pkg.InstancesWithTag(apiKey, destroyRegion, destroyTag)
+        if err != nil {
+            return err
+        }
+        if len(instances) == 0 {
+            fmt.Printf("No instances tagged %s in %s\n", destroyTag, destroyRegion)
+            return nil
+        }
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "WOULD DESTROY\tNAME\tSTATUS\tPUBLIC IP")
+        for _, inst := range instances {
+            fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", inst.ID, inst.Name, inst.Status, inst.PublicIP)
+        }
+        return w.Flush()
+    }
+
+    deleted, err := pkg.DestroyByTag(apiKey, destroyRegion, destroyTag)
+    for _, id := range deleted {
+        fmt.Println(id)
+    }
+    slog.Info("instances destroyed", "tag", destroyTag, "count", len(deleted))
+    return err
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "time"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+var (
+    installHost        string
+    installSSHKey      string
+    installSSHTimeout  time.Duration
+    installSSHPort     int
+    installSSHUser     string
+    installKnownHosts  string
+    installHomeDir     string
+    installWorkDir     string
+    installInstallers  []string
+    installAptPackages []string
+)
+
+// installCmd installs software on an instance that already exists
+var installCmd = &cobra.Command{
+    Use:   "install",
+    Short: "Install DevOps tooling on an existing instance",
+    Long: `Install software on an instance that already exists, for example one created
+outside DevOpsMate, without provisioning anything.
+
+Installers that need the Civo API, such as kubernetes, are not supported here;
+use create instead.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if err := requireSSHAuth(installSSHKey); err != nil {
+            return err
+        }
+        instance := pkg.InstanceDetails{
+            PublicIP:          installHost,
+            SSHKey:            installSSHKey,
+            Password:          os.Getenv(sshPasswordEnv),
+            SSHKeyPassphrase:  os.Getenv(sshKeyPassphraseEnv),
+            SSHUser:           installSSHUser,
+            SSHPort:           installSSHPort,
+            SSHConnectTimeout: installSSHTimeout,
+            KnownHostsFile:    installKnownHosts,
+            SudoPassword:      os.Getenv(sudoPasswordEnv),
+            HomeDir:           installHomeDir,
+            WorkDir:           installWorkDir,
+        }
+
+        if !pkg.SSHReachable(cmd.Context(), instance) {
+            return fmt.Errorf("host %s is not reachable on port %d within %s", installHost, installSSHPort, installSSHTimeout)
+        }
+
+        configured, err := withAptPackages(configuredInstallers, installAptPackages, installInstallers)
+        if err != nil {
+            return err
+        }
+        return pkg.InstallOnExisting(instance, installInstallers, configured...)
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(installCmd)
+
+    installCmd.Flags().StringVar(&installHost, "host", "", "Public IP of the instance")
+    installCmd.Flags().StringVar(&installSSHKey, "ssh-key", "", "Path to the SSH private key (set $DEVOPSMATE_SSH_KEY_PASSPHRASE if it is encrypted, or $DEVOPSMATE_SSH_PASSWORD to log in with a password instead)")
+    installCmd.Flags().StringVar(&installSSHUser, "ssh-user", pkg.DefaultSSHUser, "SSH user to log in as (set $DEVOPSMATE_SUDO_PASSWORD if it needs a password for sudo)")
+    installCmd.Flags().IntVar(&installSSHPort, "ssh-port", pkg.DefaultSSHPort, "Port sshd listens on")
+    installCmd.Flags().DurationVar(&installSSHTimeout, "ssh-connect-timeout", pkg.DefaultSSHConnectTimeout, "Give up on an SSH connection attempt after this long")
+    installCmd.Flags().StringVar(&installKnownHosts, "known-hosts", "", "Verify the instance host key against this known_hosts file (recommended)")
+    installCmd.Flags().StringVar(&installHomeDir, "home-dir", "", "Home directory of the SSH user, if not the login default")
+    installCmd.Flags().StringVar(&installWorkDir, "workdir", "", "Directory to run remote commands in")
+    installCmd.Flags().StringSliceVar(&installInstallers, "installers", nil, "Installers to run, e.g. jenkins,docker")
+    installCmd.Flags().StringSliceVar(&installAptPackages, "apt-packages", nil, "Packages for the apt-packages installer to install, e.g. git,jq")
+    installCmd.MarkFlagRequired("host")
+    installCmd.MarkFlagRequired("installers")
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "text/tabwriter"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+var (
+    listAPIKey string
+    listRegion string
+)
+
+// listCmd prints the instances in a region
+var listCmd = &cobra.Command{
+    Use:   "list",
+    Short: "List Civo compute instances",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        apiKey, err := resolveAPIKey(listAPIKey)
+        if err != nil {
+            return err
+        }
+
+        instances, err := pkg.ListComputeInstances(apiKey, listRegion)
+        if err != nil {
+            return err
+        }
+
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "ID\tNAME\tSTATUS\tPUBLIC IP\tTAGS")
+        for _, inst := range instances {
+            fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", inst.ID, inst.Name, inst.Status, inst.PublicIP, strings.Join(inst.Tags, ","))
+        }
+        return w.Flush()
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(listCmd)
+
+    listCmd.Flags().StringVar(&listAPIKey, "api-key", "", "Civo API key (defaults to $CIVO_API_KEY)")
+    listCmd.Flags().StringVar(&listRegion, "region", pkg.DefaultRegion, "Civo region code")
+}
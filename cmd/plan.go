@@ -0,0 +1,53 @@
+package cmd
+
+import (
+    "fmt"
+    "strings"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+var (
+    planInstallers  []string
+    planAptPackages []string
+)
+
+// planCmd shows the order installers would run in without creating anything
+var planCmd = &cobra.Command{
+    Use:   "plan",
+    Short: "Check an installer selection and show the order it would run in",
+    Long: `Resolve the selected installers and their dependencies, reporting unknown
+installers, missing dependencies and cycles, and print the stages they would
+run in. Installers in the same stage may run in parallel. Nothing is created.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        installers, skip, err := parseInstallers(planInstallers)
+        if err != nil {
+            return err
+        }
+        if skip {
+            fmt.Println("No installers selected")
+            return nil
+        }
+
+        configured, err := withAptPackages(configuredInstallers, planAptPackages, installers)
+        if err != nil {
+            return err
+        }
+        plan, err := pkg.InstanceOptions{Installers: installers, Configured: configured}.Plan()
+        if err != nil {
+            return err
+        }
+        for i, stage := range plan {
+            fmt.Printf("Stage %d: %s\n", i+1, strings.Join(stage, ", "))
+        }
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(planCmd)
+
+    planCmd.Flags().StringSliceVar(&planInstallers, "installers", nil, "Installers to check: all, none or a list of names (defaults to jenkins,sonarqube,buildpack,kubernetes)")
+    planCmd.Flags().StringSliceVar(&planAptPackages, "apt-packages", nil, "Packages for the apt-packages installer to install, e.g. git,jq")
+}
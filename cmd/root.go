@@ -1,16 +1,60 @@
 package cmd
 
 import (
+    "errors"
     "fmt"
-    "github.com/spf13/cobra"
+    "log/slog"
     "os"
+    "strings"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+    "github.com/spf13/pflag"
+    "github.com/spf13/viper"
 )
 
+// logLevel is the minimum level of log messages written to stderr
+var logLevel string
+
+// configFile is the path given by --config
+var configFile string
+
+// installerFile is the path given by --installer-file
+var installerFile string
+
+// installerConfigFile is the path given by --installer-config
+var installerConfigFile string
+
+// configuredInstallers are the built-in installers with the options read from
+// --installer-config, used in place of the registered ones
+var configuredInstallers []pkg.SoftwareInstaller
+
 // RootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
     Use:   "devopsmate",
     Short: "DevOpsMate is a CLI tool",
     Long:  `A longer description of your DevOpsMate CLI tool.`,
+    PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+        if err := loadConfig(cmd); err != nil {
+            return err
+        }
+        if err := setupLogging(logLevel); err != nil {
+            return err
+        }
+        if installerFile != "" {
+            if err := pkg.RegisterScriptInstallers(installerFile); err != nil {
+                return err
+            }
+        }
+        if installerConfigFile != "" {
+            installers, err := pkg.LoadInstallerConfig(installerConfigFile)
+            if err != nil {
+                return err
+            }
+            configuredInstallers = installers
+        }
+        return nil
+    },
     Run: func(cmd *cobra.Command, args []string) {
         fmt.Println("Hello from DevOpsMate CLI!")
     },
@@ -19,7 +63,157 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
     if err := rootCmd.Execute(); err != nil {
-        fmt.Println(err)
-        os.Exit(1)
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(exitCode(err))
     }
 }
+
+// Exit codes for the failures scripts most often need to tell apart. Any
+// other error exits with 1.
+const (
+    exitAuth            = 3
+    exitInstanceTimeout = 4
+    exitSSHUnreachable  = 5
+    exitInstallerFailed = 6
+)
+
+// exitCode returns the process exit code for err
+func exitCode(err error) int {
+    var installerErr *pkg.InstallerError
+    switch {
+    case errors.Is(err, pkg.ErrAuth):
+        return exitAuth
+    case errors.Is(err, pkg.ErrInstanceTimeout):
+        return exitInstanceTimeout
+    case errors.Is(err, pkg.ErrSSHUnreachable):
+        return exitSSHUnreachable
+    case errors.As(err, &installerErr):
+        return exitInstallerFailed
+    }
+    return 1
+}
+
+func init() {
+    rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level: debug, info, warn or error")
+    rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file (default $HOME/.devopsmate.yaml)")
+    rootCmd.PersistentFlags().StringVar(&installerFile, "installer-file", "", "JSON file of extra installers defined by shell commands")
+    rootCmd.PersistentFlags().StringVar(&installerConfigFile, "installer-config", "", `JSON file of options for built-in installers, keyed by name, e.g. {"jenkins": {"plugins": ["git"]}}`)
+}
+
+// configEnvPrefix prefixes the environment variables that set flags, e.g.
+// DEVOPSMATE_REGION for --region
+const configEnvPrefix = "DEVOPSMATE"
+
+// configEnvName returns the environment variable for a flag, e.g.
+// DEVOPSMATE_SSH_KEY for ssh-key
+func configEnvName(flag string) string {
+    return configEnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// loadConfig applies the environment and config file to the flags of cmd.
+// Config keys are flag names, e.g. region, size or installers. Values
+// resolve as DEVOPSMATE_<NAME> environment variable, then flag, then config
+// file, then the flag's default, so the environment overrides even flags
+// given on the command line.
+func loadConfig(cmd *cobra.Command) error {
+    v := viper.New()
+    if configFile != "" {
+        if _, err := os.Stat(configFile); err != nil {
+            return fmt.Errorf("error reading config file: %w", err)
+        }
+        v.SetConfigFile(configFile)
+    } else if home, err := os.UserHomeDir(); err == nil {
+        v.AddConfigPath(home)
+        v.SetConfigName(".devopsmate")
+        v.SetConfigType("yaml")
+    }
+    if err := v.ReadInConfig(); err != nil {
+        var notFound viper.ConfigFileNotFoundError
+        if configFile != "" || !errors.As(err, &notFound) {
+            return fmt.Errorf("error reading config file: %w", err)
+        }
+    }
+
+    var errs []error
+    cmd.Flags().VisitAll(func(f *pflag.Flag) {
+        if f.Name == "config" {
+            return
+        }
+        if value, ok := os.LookupEnv(configEnvName(f.Name)); ok {
+            if err := setFlag(cmd.Flags(), f, strings.Split(value, ",")); err != nil {
+                errs = append(errs, fmt.Errorf("invalid %s: %w", configEnvName(f.Name), err))
+            }
+            return
+        }
+        if f.Changed || !v.IsSet(f.Name) {
+            return
+        }
+        values := []string{v.GetString(f.Name)}
+        if _, isSlice := f.Value.(pflag.SliceValue); isSlice {
+            values = v.GetStringSlice(f.Name)
+        }
+        if err := setFlag(cmd.Flags(), f, values); err != nil {
+            errs = append(errs, fmt.Errorf("invalid config value for %s: %w", f.Name, err))
+        }
+    })
+    return errors.Join(errs...)
+}
+
+// setFlag sets f to values, replacing anything already given on the command
+// line. Only slice flags take more than one value; other flags are set to
+// the values joined with commas, as they were written.
+func setFlag(flags *pflag.FlagSet, f *pflag.Flag, values []string) error {
+    if sv, isSlice := f.Value.(pflag.SliceValue); isSlice {
+        if err := sv.Replace(values); err != nil {
+            return err
+        }
+        f.Changed = true
+        return nil
+    }
+    return flags.Set(f.Name, strings.Join(values, ","))
+}
+
+// setupLogging installs a text slog handler on stderr at the given level as the default logger
+func setupLogging(level string) error {
+    var l slog.Level
+    if err := l.UnmarshalText([]byte(level)); err != nil {
+        return fmt.Errorf("invalid --log-level %q: must be debug, info, warn or error", level)
+    }
+    slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: l})))
+    return nil
+}
+
+// apiKeyEnv is the environment variable read when --api-key is not given
+const apiKeyEnv = "CIVO_API_KEY"
+
+// resolveAPIKey returns the --api-key flag value, falling back to CIVO_API_KEY
+func resolveAPIKey(flag string) (string, error) {
+    if flag != "" {
+        return flag, nil
+    }
+    if key := os.Getenv(apiKeyEnv); key != "" {
+        return key, nil
+    }
+    return "", fmt.Errorf("no Civo API key: pass --api-key or set %s", apiKeyEnv)
+}
+
+// sshKeyPassphraseEnv is the environment variable holding the passphrase of an
+// encrypted SSH key. It is read from the environment so it stays out of shell history.
+const sshKeyPassphraseEnv = "DEVOPSMATE_SSH_KEY_PASSPHRASE"
+
+// sshPasswordEnv is the environment variable holding the SSH login password,
+// for existing instances reached without a key
+const sshPasswordEnv = "DEVOPSMATE_SSH_PASSWORD"
+
+// requireSSHAuth checks that there is a way to log in to an existing
+// instance: a private key, a password, or both
+func requireSSHAuth(keyPath string) error {
+    if keyPath == "" && os.Getenv(sshPasswordEnv) == "" {
+        return fmt.Errorf("no way to log in: pass --ssh-key or set %s", sshPasswordEnv)
+    }
+    return nil
+}
+
+// sudoPasswordEnv is the environment variable holding the sudo password of
+// the SSH user, for images without passwordless sudo
+const sudoPasswordEnv = "DEVOPSMATE_SUDO_PASSWORD"
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+
+    "github.com/spf13/cobra"
+)
+
+func TestLoadConfig(t *testing.T) {
+    tests := []struct {
+        name           string
+        config         string
+        args           []string
+        env            map[string]string
+        wantRegion     string
+        wantInstallers []string
+    }{
+        {
+            name:           "default",
+            wantRegion:     "LON1",
+            wantInstallers: []string{"jenkins"},
+        },
+        {
+            name:           "config file over default",
+            config:         "region: NYC1\ninstallers: [docker, helm]\n",
+            wantRegion:     "NYC1",
+            wantInstallers: []string{"docker", "helm"},
+        },
+        {
+            name:           "flag over config file",
+            config:         "region: NYC1\ninstallers: [docker, helm]\n",
+            args:           []string{"--region", "FRA1", "--installers", "trivy"},
+            wantRegion:     "FRA1",
+            wantInstallers: []string{"trivy"},
+        },
+        {
+            name:           "environment over flag and config file",
+            config:         "region: NYC1\ninstallers: [docker, helm]\n",
+            args:           []string{"--region", "FRA1", "--installers", "trivy"},
+            env:            map[string]string{"DEVOPSMATE_REGION": "PHX1", "DEVOPSMATE_INSTALLERS": "nginx,redis"},
+            wantRegion:     "PHX1",
+            wantInstallers: []string{"nginx", "redis"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), "devopsmate.yaml")
+            if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+                t.Fatal(err)
+            }
+            orig := configFile
+            configFile = path
+            t.Cleanup(func() { configFile = orig })
+            for _, name := range []string{"DEVOPSMATE_REGION", "DEVOPSMATE_INSTALLERS"} {
+                t.Setenv(name, "")
+                os.Unsetenv(name)
+            }
+            for name, value := range tt.env {
+                t.Setenv(name, value)
+            }
+
+            cmd := &cobra.Command{Use: "test"}
+            region := cmd.Flags().String("region", "LON1", "")
+            installers := cmd.Flags().StringSlice("installers", []string{"jenkins"}, "")
+            if err := cmd.ParseFlags(tt.args); err != nil {
+                t.Fatal(err)
+            }
+
+            if err := loadConfig(cmd); err != nil {
+                t.Fatalf("loadConfig: %v", err)
+            }
+            if *region != tt.wantRegion {
+                t.Errorf("got region %q, want %q", *region, tt.wantRegion)
+            }
+            if !reflect.DeepEqual(*installers, tt.wantInstallers) {
+                t.Errorf("got installers %v, want %v", *installers, tt.wantInstallers)
+            }
+        })
+    }
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net"
+    "net/http"
+    "os"
+    "os/signal"
+    "strconv"
+    "sync/atomic"
+    "syscall"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "github.com/spf13/cobra"
+    "golang.org/x/crypto/acme/autocert"
+)
+
+// shutdownTimeout is how long in-flight requests get to finish on shutdown
+const shutdownTimeout = 15 * time.Second
+
+var (
+    // servePort is the port the server listens on
+    servePort int
+    // serveAccessLog enables per-request logging
+    serveAccessLog bool
+    // serveRootMode selects what / serves: "json" or "text"
+    serveRootMode string
+    // serveTLSCert and serveTLSKey enable HTTPS with a certificate from disk
+    serveTLSCert string
+    serveTLSKey  string
+    // serveAutocertDomains enables HTTPS with Let's Encrypt certificates for these hosts
+    serveAutocertDomains []string
+    // serveAutocertCache is where Let's Encrypt certificates are stored
+    serveAutocertCache string
+)
+
+// serveCmd runs the DevOpsMate HTTP server
+var serveCmd = &cobra.Command{
+    Use:   "serve",
+    Short: "Run the DevOpsMate HTTP server",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        port, err := resolvePort(servePort, cmd.Flags().Changed("port"))
+        if err != nil {
+            return err
+        }
+        if (serveTLSCert == "") != (serveTLSKey == "") {
+            return errors.New("--tls-cert and --tls-key must be given together")
+        }
+        if serveTLSCert != "" && len(serveAutocertDomains) > 0 {
+            return errors.New("--tls-cert and --autocert-domain cannot be combined")
+        }
+
+        var ready atomic.Bool
+
+        mux := http.NewServeMux()
+        switch serveRootMode {
+        case "json":
+            mux.HandleFunc("/{$}", statusHandler(time.Now()))
+        case "text":
+            mux.HandleFunc("/", helloHandler)
+        default:
+            return fmt.Errorf("invalid --root-mode %q: must be json or text", serveRootMode)
+        }
+        mux.HandleFunc("/healthz", healthzHandler)
+        mux.HandleFunc("/readyz", readyzHandler(&ready))
+        mux.HandleFunc("/instances", instancesHandler)
+        mux.Handle("/metrics", promhttp.Handler())
+
+        var handler http.Handler = mux
+        if serveAccessLog {
+            handler = logRequests(handler, slog.Default())
+        }
+
+        server := &http.Server{
+            Addr:    fmt.Sprintf(":%d", port),
+            Handler: handler,
+        }
+        if len(serveAutocertDomains) > 0 {
+            manager := &autocert.Manager{
+                Prompt:     autocert.AcceptTOS,
+                HostPolicy: autocert.HostWhitelist(serveAutocertDomains...),
+                Cache:      autocert.DirCache(serveAutocertCache),
+            }
+            server.TLSConfig = manager.TLSConfig()
+        }
+
+        ln, err := net.Listen("tcp", server.Addr)
+        if err != nil {
+            return err
+        }
+
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+        defer stop()
+
+        errc := make(chan error, 1)
+        go func() {
+            if serveTLSCert != "" || server.TLSConfig != nil {
+                slog.Info("server listening", "addr", ln.Addr(), "tls", true)
+                errc <- server.ServeTLS(ln, serveTLSCert, serveTLSKey)
+                return
+            }
+            slog.Info("server listening", "addr", ln.Addr())
+            errc <- server.Serve(ln)
+        }()
+        ready.Store(true)
+
+        select {
+        case err := <-errc:
+            return err
+        case <-ctx.Done():
+        }
+
+        slog.Info("shutting down server")
+        ready.Store(false)
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+        defer cancel()
+        if err := server.Shutdown(shutdownCtx); err != nil {
+            return fmt.Errorf("error shutting down server: %w", err)
+        }
+        if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+            return err
+        }
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(serveCmd)
+
+    serveCmd.Flags().IntVar(&servePort, "port", 8080, "Port to listen on, overriding $PORT")
+    serveCmd.Flags().BoolVar(&serveAccessLog, "access-log", true, "Log every request")
+    serveCmd.Flags().StringVar(&serveTLSCert, "tls-cert", "", "TLS certificate file; serves HTTPS together with --tls-key")
+    serveCmd.Flags().StringVar(&serveTLSKey, "tls-key", "", "TLS private key file")
+    serveCmd.Flags().StringSliceVar(&serveAutocertDomains, "autocert-domain", nil, "Serve HTTPS with Let's Encrypt certificates for these domains (the port must be reachable as 443)")
+    serveCmd.Flags().StringVar(&serveAutocertCache, "autocert-cache", "autocert-cache", "Directory Let's Encrypt certificates are cached in")
+    serveCmd.Flags().StringVar(&serveRootMode, "root-mode", "json", `What / serves: "json" for server status or "text" for the plain greeting`)
+}
+
+// resolvePort returns the --port flag if it was set, else $PORT, else the flag default
+func resolvePort(flag int, flagSet bool) (int, error) {
+    port := flag
+    if env := os.Getenv("PORT"); env != "" && !flagSet {
+        p, err := strconv.Atoi(env)
+        if err != nil {
+            return 0, fmt.Errorf("invalid PORT %q: %w", env, err)
+        }
+        port = p
+    }
+    if port < 1 || port > 65535 {
+        return 0, fmt.Errorf("invalid port %d: must be between 1 and 65535", port)
+    }
+    return port, nil
+}
+
+// helloHandler answers every request with a greeting
+func helloHandler(w http.ResponseWriter, r *http.Request) {
+    fmt.Fprintln(w, "Hello, World!")
+}
+
+// serverStatus is the body served on / in json mode
+type serverStatus struct {
+    Version       string  `json:"version"`
+    Uptime        string  `json:"uptime"`
+    UptimeSeconds float64 `json:"uptimeSeconds"`
+    ActiveJobs    int64   `json:"activeJobs"`
+}
+
+// statusHandler reports the server version, time since started and the
+// number of provisioning requests in progress
+func statusHandler(started time.Time) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        uptime := time.Since(started)
+        writeJSON(w, http.StatusOK, serverStatus{
+            Version:       Version,
+            Uptime:        uptime.Round(time.Second).String(),
+            UptimeSeconds: uptime.Seconds(),
+            ActiveJobs:    activeJobs.Load(),
+        })
+    }
+}
+
+// healthzHandler reports that the process is alive
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyzHandler reports 503 until ready is set, then 200
+func readyzHandler(ready *atomic.Bool) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if !ready.Load() {
+            writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "starting"})
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+    }
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if err := json.NewEncoder(w).Encode(v); err != nil {
+        slog.Error("error writing response", "err", err)
+    }
+}
+
+// logRequests wraps next so that every request is logged with its method,
+// path, response status and duration
+func logRequests(next http.Handler, logger *slog.Logger) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+        next.ServeHTTP(rec, r)
+        logger.Info("request",
+            "method", r.Method,
+            "path", r.URL.Path,
+            "status", rec.status,
+            "duration", time.Since(start),
+        )
+    })
+}
+
+// statusRecorder remembers the status code written through it
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+    r.status = status
+    r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+    "fmt"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+var (
+    sshKeyAPIKey string
+    sshKeyRegion string
+    sshKeyName   string
+    sshKeyOut    string
+)
+
+// sshKeyCmd generates an SSH key pair and registers it with Civo
+var sshKeyCmd = &cobra.Command{
+    Use:   "ssh-key",
+    Short: "Generate an ed25519 SSH key and upload it to Civo",
+    Long: `Generate an ed25519 SSH key pair, save the private key locally and register
+the public key with Civo. Pass the printed ID to create with --ssh-key-id.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        apiKey, err := resolveAPIKey(sshKeyAPIKey)
+        if err != nil {
+            return err
+        }
+
+        id, err := pkg.GenerateSSHKey(apiKey, sshKeyRegion, sshKeyName, sshKeyOut)
+        if err != nil {
+            return err
+        }
+        fmt.Printf("SSH key ID:  %s\n", id)
+        fmt.Printf("Private key: %s\n", sshKeyOut)
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(sshKeyCmd)
+
+    sshKeyCmd.Flags().StringVar(&sshKeyAPIKey, "api-key", "", "Civo API key (defaults to $CIVO_API_KEY)")
+    sshKeyCmd.Flags().StringVar(&sshKeyRegion, "region", pkg.DefaultRegion, "Civo region code")
+    sshKeyCmd.Flags().StringVar(&sshKeyName, "name", "devopsmate", "Name of the key in Civo")
+    sshKeyCmd.Flags().StringVar(&sshKeyOut, "out", "", "Path to write the private key to")
+    sshKeyCmd.MarkFlagRequired("out")
+}
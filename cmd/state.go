@@ -0,0 +1,108 @@
+package cmd
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "slices"
+    "time"
+
+    "devopsmate/pkg"
+)
+
+// runState records how far a create run got, so a failed run can be resumed
+// against the instance it created instead of starting over
+type runState struct {
+    RunID      string `json:"runId"`
+    InstanceID string `json:"instanceId"`
+    Region     string `json:"region"`
+    // Installers is the selection the run was started with; empty means the default set
+    Installers []string `json:"installers,omitempty"`
+    // Completed names the installers that succeeded
+    Completed []string  `json:"completed,omitempty"`
+    UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// newRunID returns a random identifier for a create run
+func newRunID() (string, error) {
+    b := make([]byte, 6)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("error generating run ID: %w", err)
+    }
+    return hex.EncodeToString(b), nil
+}
+
+// runStatePath returns the file the state of runID is kept in, under
+// $HOME/.devopsmate/runs
+func runStatePath(runID string) (string, error) {
+    if runID == "" || filepath.Base(runID) != runID || runID == "." || runID == ".." {
+        return "", fmt.Errorf("invalid run ID %q", runID)
+    }
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return "", fmt.Errorf("error finding home directory: %w", err)
+    }
+    return filepath.Join(home, ".devopsmate", "runs", runID+".json"), nil
+}
+
+// loadRunState reads the saved state of runID
+func loadRunState(runID string) (runState, error) {
+    path, err := runStatePath(runID)
+    if err != nil {
+        return runState{}, err
+    }
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return runState{}, fmt.Errorf("no saved run %s", runID)
+    }
+    if err != nil {
+        return runState{}, fmt.Errorf("error reading run state: %w", err)
+    }
+    var state runState
+    if err := json.Unmarshal(data, &state); err != nil {
+        return runState{}, fmt.Errorf("error parsing run state %s: %w", path, err)
+    }
+    return state, nil
+}
+
+// save records the installers that succeeded in results and writes the state
+func (s runState) save(results []pkg.InstallResult) error {
+    for _, result := range results {
+        if result.Success && !slices.Contains(s.Completed, result.Installer) {
+            s.Completed = append(s.Completed, result.Installer)
+        }
+    }
+    s.UpdatedAt = time.Now().UTC()
+
+    path, err := runStatePath(s.RunID)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+        return fmt.Errorf("error creating run state directory: %w", err)
+    }
+    data, err := json.MarshalIndent(s, "", "  ")
+    if err != nil {
+        return fmt.Errorf("error encoding run state: %w", err)
+    }
+    if err := os.WriteFile(path, data, 0o600); err != nil {
+        return fmt.Errorf("error writing run state: %w", err)
+    }
+    return nil
+}
+
+// remove deletes the saved state, if any
+func (s runState) remove() error {
+    path, err := runStatePath(s.RunID)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return fmt.Errorf("error removing run state: %w", err)
+    }
+    return nil
+}
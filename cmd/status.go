@@ -0,0 +1,73 @@
+package cmd
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+var (
+    statusAPIKey   string
+    statusRegion   string
+    statusID       string
+    statusWatch    bool
+    statusInterval time.Duration
+)
+
+// sshProbeTimeout bounds each SSH reachability check made by status
+const sshProbeTimeout = 5 * time.Second
+
+// statusCmd reports the state of an instance
+var statusCmd = &cobra.Command{
+    Use:   "status",
+    Short: "Show the status of a Civo compute instance",
+    RunE: func(cmd *cobra.Command, args []string) error {
+        apiKey, err := resolveAPIKey(statusAPIKey)
+        if err != nil {
+            return err
+        }
+
+        for {
+            instance, err := pkg.GetComputeInstance(apiKey, statusRegion, statusID)
+            if err != nil {
+                return err
+            }
+
+            ctx, cancel := context.WithTimeout(cmd.Context(), sshProbeTimeout)
+            ssh := "unreachable"
+            if pkg.SSHReachable(ctx, instance) {
+                ssh = "reachable"
+            }
+            cancel()
+
+            fmt.Printf("Status:    %s\n", instance.Status)
+            fmt.Printf("Public IP: %s\n", instance.PublicIP)
+            fmt.Printf("SSH:       %s\n", ssh)
+
+            if !statusWatch || instance.Status == "ACTIVE" {
+                return nil
+            }
+
+            select {
+            case <-cmd.Context().Done():
+                return cmd.Context().Err()
+            case <-time.After(statusInterval):
+            }
+            fmt.Println()
+        }
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(statusCmd)
+
+    statusCmd.Flags().StringVar(&statusAPIKey, "api-key", "", "Civo API key (defaults to $CIVO_API_KEY)")
+    statusCmd.Flags().StringVar(&statusRegion, "region", pkg.DefaultRegion, "Civo region code")
+    statusCmd.Flags().StringVar(&statusID, "id", "", "ID of the instance")
+    statusCmd.Flags().BoolVar(&statusWatch, "watch", false, "Keep polling until the instance is ACTIVE")
+    statusCmd.Flags().DurationVar(&statusInterval, "interval", pkg.DefaultPollInterval, "Poll interval used with --watch")
+    statusCmd.MarkFlagRequired("id")
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "os"
+    "strings"
+    "time"
+
+    "devopsmate/pkg"
+    "github.com/spf13/cobra"
+)
+
+var (
+    uninstallHost       string
+    uninstallSSHKey     string
+    uninstallSSHTimeout time.Duration
+    uninstallSSHPort    int
+    uninstallSSHUser    string
+    uninstallKnownHosts string
+    uninstallHomeDir    string
+    uninstallWorkDir    string
+    uninstallAPIKey     string
+    uninstallRegion     string
+    uninstallHostname   string
+)
+
+// uninstallCmd removes software previously installed by DevOpsMate
+var uninstallCmd = &cobra.Command{
+    Use:   "uninstall <software>...",
+    Short: "Remove installed software from an instance",
+    Long: `Remove software installed by DevOpsMate from an instance.
+
+Valid software names are those of the registered installers: ` + strings.Join(pkg.RegisteredInstallers(), ", ") + ".",
+    Args: cobra.MinimumNArgs(1),
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if err := requireSSHAuth(uninstallSSHKey); err != nil {
+            return err
+        }
+        instance := pkg.InstanceDetails{
+            Name:              uninstallHostname,
+            PublicIP:          uninstallHost,
+            SSHKey:            uninstallSSHKey,
+            Password:          os.Getenv(sshPasswordEnv),
+            SSHKeyPassphrase:  os.Getenv(sshKeyPassphraseEnv),
+            SSHUser:           uninstallSSHUser,
+            SSHPort:           uninstallSSHPort,
+            SSHConnectTimeout: uninstallSSHTimeout,
+            KnownHostsFile:    uninstallKnownHosts,
+            SudoPassword:      os.Getenv(sudoPasswordEnv),
+            HomeDir:           uninstallHomeDir,
+            WorkDir:           uninstallWorkDir,
+        }
+
+        for _, name := range args {
+            installer, ok := configuredInstaller(name)
+            if !ok {
+                return fmt.Errorf("unknown software %q", name)
+            }
+            if pkg.UsesCivoAPI(installer) {
+                apiKey, err := resolveAPIKey(uninstallAPIKey)
+                if err != nil {
+                    return fmt.Errorf("%s needs the Civo API: %w", name, err)
+                }
+                installer = pkg.WithCivoCredentials(installer, apiKey, uninstallRegion)
+            }
+            if err := installer.Uninstall(context.Background(), instance); err != nil {
+                return fmt.Errorf("error uninstalling %s: %w", name, err)
+            }
+            slog.Info("uninstalled", "software", name)
+        }
+        return nil
+    },
+}
+
+// configuredInstaller returns the installer named name from --installer-config,
+// falling back to the registered one
+func configuredInstaller(name string) (pkg.SoftwareInstaller, bool) {
+    for _, installer := range configuredInstallers {
+        if installer.Name() == name {
+            return installer, true
+        }
+    }
+    return pkg.LookupInstaller(name)
+}
+
+func init() {
+    rootCmd.AddCommand(uninstallCmd)
+
+    uninstallCmd.Flags().StringVar(&uninstallHost, "host", "", "Public IP of the instance")
+    uninstallCmd.Flags().StringVar(&uninstallSSHKey, "ssh-key", "", "Path to the SSH private key (set $DEVOPSMATE_SSH_KEY_PASSPHRASE if it is encrypted, or $DEVOPSMATE_SSH_PASSWORD to log in with a password instead)")
+    uninstallCmd.Flags().StringVar(&uninstallSSHUser, "ssh-user", pkg.DefaultSSHUser, "SSH user to log in as (set $DEVOPSMATE_SUDO_PASSWORD if it needs a password for sudo)")
+    uninstallCmd.Flags().IntVar(&uninstallSSHPort, "ssh-port", pkg.DefaultSSHPort, "Port sshd listens on")
+    uninstallCmd.Flags().DurationVar(&uninstallSSHTimeout, "ssh-connect-timeout", pkg.DefaultSSHConnectTimeout, "Give up on an SSH connection attempt after this long")
+    uninstallCmd.Flags().StringVar(&uninstallKnownHosts, "known-hosts", "", "Verify the instance host key against this known_hosts file (recommended)")
+    uninstallCmd.Flags().StringVar(&uninstallHomeDir, "home-dir", "", "Home directory of the SSH user, if not the login default")
+    uninstallCmd.Flags().StringVar(&uninstallWorkDir, "workdir", "", "Directory to run remote commands in")
+    uninstallCmd.Flags().StringVar(&uninstallAPIKey, "api-key", "", "Civo API key, needed to uninstall kubernetes (defaults to $CIVO_API_KEY)")
+    uninstallCmd.Flags().StringVar(&uninstallRegion, "region", pkg.DefaultRegion, "Civo region code")
+    uninstallCmd.Flags().StringVar(&uninstallHostname, "hostname", "", "Hostname of the instance, which names the Kubernetes cluster created for it")
+    uninstallCmd.MarkFlagRequired("host")
+}
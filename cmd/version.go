@@ -0,0 +1,29 @@
+package cmd
+
+import (
+    "fmt"
+
+    "github.com/spf13/cobra"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X devopsmate/cmd.Version=v1.0.0 -X devopsmate/cmd.Commit=$(git rev-parse --short HEAD) -X devopsmate/cmd.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+    Version   = "dev"
+    Commit    = "none"
+    BuildDate = "unknown"
+)
+
+// versionCmd prints the build information
+var versionCmd = &cobra.Command{
+    Use:   "version",
+    Short: "Print the DevOpsMate version",
+    Run: func(cmd *cobra.Command, args []string) {
+        fmt.Printf("devopsmate %s (commit %s, built %s)\n", Version, Commit, BuildDate)
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(versionCmd)
+}
@@ -0,0 +1,62 @@
+package pkg
+
+import (
+    "context"
+)
+
+// ansiblePipxEnv installs pipx applications system wide so ansible is on
+// every user's PATH
+const ansiblePipxEnv = "PIPX_HOME=/opt/pipx PIPX_BIN_DIR=/usr/local/bin"
+
+// AnsibleInstaller installs Ansible with pipx
+type AnsibleInstaller struct {
+    // Version is the ansible package release, e.g. "10.5.0". Empty installs
+    // the latest release.
+    Version string
+}
+
+// Name returns "ansible"
+func (a AnsibleInstaller) Name() string { return "ansible" }
+
+// DependsOn returns no dependencies
+func (a AnsibleInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the ansible CLI is on the PATH and, if a
+// version is pinned, that pipx installed that version
+func (a AnsibleInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, "command -v ansible"+a.versionCheckScript())
+}
+
+// Install installs the pinned Ansible release and its command line tools
+func (a AnsibleInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    spec := "ansible"
+    if a.Version != "" {
+        spec += "==" + a.Version
+    }
+    script := `sudo apt-get update &&
+sudo apt-get install -y pipx &&
+sudo ` + ansiblePipxEnv + ` pipx install --include-deps ` + shellQuote(spec)
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that the ansible CLI runs and is the pinned version
+func (a AnsibleInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "ansible --version"+a.versionCheckScript())
+    return err
+}
+
+// versionCheckScript returns a check, to append to another with &&, that
+// pipx reports the pinned ansible release. It is empty if none is pinned.
+func (a AnsibleInstaller) versionCheckScript() string {
+    if a.Version == "" {
+        return ""
+    }
+    return " && sudo " + ansiblePipxEnv + " pipx list --short | grep -qxF " + shellQuote("ansible "+a.Version)
+}
+
+// Uninstall removes Ansible from the instance
+func (a AnsibleInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "sudo "+ansiblePipxEnv+" pipx uninstall ansible")
+    return err
+}
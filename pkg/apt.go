@@ -0,0 +1,90 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "strings"
+)
+
+// AptPackagesInstaller installs arbitrary packages from the instance's apt
+// repositories, for tools too small to need their own installer
+type AptPackagesInstaller struct {
+    // Packages are the apt package names to install, e.g. git, make, jq
+    Packages []string
+}
+
+// Name returns "apt-packages"
+func (a AptPackagesInstaller) Name() string { return "apt-packages" }
+
+// DependsOn returns no dependencies
+func (a AptPackagesInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether every package is installed
+func (a AptPackagesInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    if len(a.Packages) == 0 {
+        return true, nil
+    }
+    return probeRemoteCommand(ctx, instance, a.installedScript())
+}
+
+// Install installs the packages with apt-get
+func (a AptPackagesInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    if len(a.Packages) == 0 {
+        return nil
+    }
+    script := `sudo apt-get update &&
+sudo DEBIAN_FRONTEND=noninteractive apt-get install -y ` + a.quoted()
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks with dpkg that every package is installed
+func (a AptPackagesInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    if len(a.Packages) == 0 {
+        return nil
+    }
+    installed, err := probeRemoteCommand(ctx, instance, a.installedScript())
+    if err != nil {
+        return err
+    }
+    if !installed {
+        return errors.New("apt-packages: not all packages are installed: " + strings.Join(a.Packages, ", "))
+    }
+    return nil
+}
+
+// Uninstall removes the packages from the instance
+func (a AptPackagesInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    if len(a.Packages) == 0 {
+        return nil
+    }
+    _, err := runRemoteCommand(ctx, instance, "sudo apt-get remove --purge -y "+a.quoted())
+    return err
+}
+
+// validate checks that there is something to install, since the registered
+// installer has no packages and would otherwise report success doing nothing
+func (a AptPackagesInstaller) validate() error {
+    if len(a.Packages) == 0 {
+        return errors.New("apt-packages: no packages to install")
+    }
+    return nil
+}
+
+// installedScript returns a shell check that succeeds if every package is installed
+func (a AptPackagesInstaller) installedScript() string {
+    checks := make([]string, len(a.Packages))
+    for i, pkg := range a.Packages {
+        checks[i] = dpkgInstalledScript(pkg)
+    }
+    return strings.Join(checks, " && ")
+}
+
+// quoted returns the package names quoted for the shell
+func (a AptPackagesInstaller) quoted() string {
+    quoted := make([]string, len(a.Packages))
+    for i, pkg := range a.Packages {
+        quoted[i] = shellQuote(pkg)
+    }
+    return strings.Join(quoted, " ")
+}
@@ -0,0 +1,92 @@
+package pkg
+
+import (
+    "context"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+const (
+    // DefaultArgoCDNamespace is the namespace ArgoCD is installed into when none is set
+    DefaultArgoCDNamespace = "argocd"
+    // argoCDManifestURL is the upstream manifest for the stable ArgoCD release
+    argoCDManifestURL = "https://raw.githubusercontent.com/argoproj/argo-cd/stable/manifests/install.yaml"
+)
+
+// namespacePattern matches valid Kubernetes namespace names
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// kubectlInstallScript installs the latest stable kubectl unless one is already present
+const kubectlInstallScript = `{ command -v kubectl > /dev/null || {
+curl -fsSL -o /tmp/kubectl "https://dl.k8s.io/release/$(curl -fsSL https://dl.k8s.io/release/stable.txt)/bin/linux/amd64/kubectl" &&
+sudo install -m 0755 /tmp/kubectl /usr/local/bin/kubectl &&
+rm -f /tmp/kubectl; }; }`
+
+// ArgoCDInstaller applies the ArgoCD manifests to the cluster created by the
+// kubernetes installer
+type ArgoCDInstaller struct {
+    // Namespace to install ArgoCD into. Defaults to DefaultArgoCDNamespace.
+    Namespace string
+}
+
+// Name returns "argocd"
+func (a ArgoCDInstaller) Name() string { return "argocd" }
+
+// DependsOn returns "kubernetes", whose cluster ArgoCD is installed into
+func (a ArgoCDInstaller) DependsOn() []string { return []string{"kubernetes"} }
+
+// IsInstalled reports whether the ArgoCD server deployment exists
+func (a ArgoCDInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, "command -v kubectl && kubectl -n "+shellQuote(a.namespace())+" get deployment argocd-server")
+}
+
+// Install installs kubectl if needed and applies the ArgoCD manifests. The
+// manifests hard-code the argocd namespace in their cluster role bindings, so
+// it is rewritten to the configured one.
+func (a ArgoCDInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    if !namespacePattern.MatchString(a.namespace()) {
+        return fmt.Errorf("argocd: invalid namespace %q", a.namespace())
+    }
+
+    ns := shellQuote(a.namespace())
+    script := fmt.Sprintf(`%s &&
+{ kubectl get namespace %[2]s > /dev/null 2>&1 || kubectl create namespace %[2]s; } &&
+curl -fsSL %[3]s | sed "s/namespace: argocd$/namespace: %[4]s/" | kubectl apply -n %[2]s -f -`,
+        kubectlInstallScript, ns, shellQuote(argoCDManifestURL), a.namespace())
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify waits for the ArgoCD server to finish rolling out
+func (a ArgoCDInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "kubectl -n "+shellQuote(a.namespace())+" rollout status deployment/argocd-server --timeout=300s")
+    return err
+}
+
+// Outputs returns the password of the initial admin user under the
+// "initial-admin-password" key
+func (a ArgoCDInstaller) Outputs(ctx context.Context, instance InstanceDetails) (map[string]string, error) {
+    out, err := readRemoteCommand(ctx, instance, "kubectl -n "+shellQuote(a.namespace())+" get secret argocd-initial-admin-secret -o jsonpath='{.data.password}' | base64 -d")
+    if err != nil {
+        return nil, err
+    }
+    return map[string]string{"initial-admin-password": strings.TrimSpace(out)}, nil
+}
+
+// Uninstall deletes the ArgoCD resources and namespace from the cluster
+func (a ArgoCDInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    ns := shellQuote(a.namespace())
+    script := fmt.Sprintf(`kubectl delete -n %s --ignore-not-found -f %s;
+kubectl delete namespace --ignore-not-found %s`, ns, shellQuote(argoCDManifestURL), ns)
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// namespace returns the configured namespace or DefaultArgoCDNamespace
+func (a ArgoCDInstaller) namespace() string {
+    if a.Namespace == "" {
+        return DefaultArgoCDNamespace
+    }
+    return a.Namespace
+}
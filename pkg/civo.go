@@ -1,3 +1,866 @@
 package pkg
 
-func SomeFunc(){}
\ No newline at end of file
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "slices"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/civo/civogo"
+)
+
+// InstanceDetails holds the connection details of a provisioned instance
+type InstanceDetails struct {
+    ID       string `json:"id,omitempty"`
+    Name     string `json:"name,omitempty"`
+    Status   string `json:"status,omitempty"`
+    PublicIP string `json:"publicIP,omitempty"`
+    Password string `json:"password,omitempty"`
+    SSHKey   string `json:"sshKey,omitempty"`
+    // Tags are the Civo tags on the instance
+    Tags []string `json:"tags,omitempty"`
+    // Region is the Civo region the instance was created in
+    Region string `json:"region,omitempty"`
+    // FirewallID is the firewall created for the instance from
+    // InstanceOptions.FirewallRules. It is empty when an existing firewall or
+    // Civo's default one is used. If provisioning fails before the instance
+    // exists and the firewall cannot be deleted, it is set with ID empty.
+    FirewallID string `json:"firewallId,omitempty"`
+    // KubernetesCluster names the cluster created by the kubernetes
+    // installer. It is set as soon as the cluster exists, even if the run
+    // fails afterwards.
+    KubernetesCluster string `json:"kubernetesCluster,omitempty"`
+    // SSHKeyPassphrase decrypts SSHKey when it is passphrase protected
+    SSHKeyPassphrase string `json:"-"`
+    // KnownHostsFile, when set, enables host key verification against the given
+    // known_hosts file. Empty accepts any host key.
+    KnownHostsFile string `json:"-"`
+    // SSHUser is the user installers log in as. Defaults to DefaultSSHUser.
+    SSHUser string `json:"sshUser,omitempty"`
+    // SSHPort is the port sshd listens on. Defaults to DefaultSSHPort.
+    SSHPort int `json:"sshPort,omitempty"`
+    // SSHConnectTimeout bounds each attempt to connect and complete the SSH
+    // handshake. Defaults to DefaultSSHConnectTimeout.
+    SSHConnectTimeout time.Duration `json:"-"`
+    // Outputs holds values reported by installers, keyed by
+    // "<installer>.<key>", e.g. "jenkins.initial-admin-password"
+    Outputs map[string]string `json:"outputs,omitempty"`
+    // Results records the outcome of each installer run on the instance
+    Results []InstallResult `json:"results,omitempty"`
+    // Output receives the live stdout and stderr of remote install commands.
+    // Defaults to os.Stdout.
+    Output io.Writer `json:"-"`
+    // DryRun makes installers print the commands they would run instead of
+    // connecting to the instance
+    DryRun bool `json:"dryRun,omitempty"`
+    // Runner executes installer commands on the instance. Defaults to SSHRunner.
+    Runner Runner `json:"-"`
+    // Env is exported before every remote command
+    Env map[string]string `json:"-"`
+    // SudoPassword answers sudo's password prompt, for images whose user
+    // does not have passwordless sudo. It is passed to the instance on stdin.
+    SudoPassword string `json:"-"`
+    // HomeDir overrides $HOME for remote commands, which is where files such
+    // as ~/.kube/config are kept
+    HomeDir string `json:"-"`
+    // WorkDir is the directory remote commands start in, created if needed.
+    // Defaults to the login directory.
+    WorkDir string `json:"-"`
+    // clusterCreated is called by the kubernetes installer as soon as it has
+    // created a cluster, so Install can record it whatever happens next
+    clusterCreated func(name string)
+}
+
+const (
+    // DefaultSSHUser is the login user of Civo's stock images
+    DefaultSSHUser = "civo"
+    // DefaultSSHPort is the port sshd listens on in Civo's stock images
+    DefaultSSHPort = 22
+    // DefaultSSHConnectTimeout bounds each SSH connection attempt when no timeout is set
+    DefaultSSHConnectTimeout = 30 * time.Second
+)
+
+// sshUser returns the user to log in as, falling back to DefaultSSHUser
+func (i InstanceDetails) sshUser() string {
+    if i.SSHUser == "" {
+        return DefaultSSHUser
+    }
+    return i.SSHUser
+}
+
+// sshPort returns the port to connect to, falling back to DefaultSSHPort
+func (i InstanceDetails) sshPort() int {
+    if i.SSHPort == 0 {
+        return DefaultSSHPort
+    }
+    return i.SSHPort
+}
+
+// sshConnectTimeout returns the SSH connect timeout, falling back to DefaultSSHConnectTimeout
+func (i InstanceDetails) sshConnectTimeout() time.Duration {
+    if i.SSHConnectTimeout <= 0 {
+        return DefaultSSHConnectTimeout
+    }
+    return i.SSHConnectTimeout
+}
+
+// output returns where remote command output is streamed, falling back to os.Stdout
+func (i InstanceDetails) output() io.Writer {
+    if i.Output == nil {
+        return os.Stdout
+    }
+    return i.Output
+}
+
+// InstanceOptions customises the instance created by CreateComputeInstance.
+// Zero values keep Civo's defaults.
+type InstanceOptions struct {
+    // Size is the Civo instance size, e.g. "g3.medium"
+    Size string
+    // PollInterval is the delay before the second instance status check while
+    // waiting for it to become active. The delay doubles after each check up
+    // to MaxPollInterval. Defaults to DefaultInitialPollInterval.
+    PollInterval time.Duration
+    // Timeout bounds the whole provisioning run. Defaults to DefaultTimeout.
+    Timeout time.Duration
+    // Parallelism is the maximum number of installers run at once. Installers
+    // that depend on each other always run in order. Defaults to 1.
+    Parallelism int
+    // InstallerTimeout bounds each installer's Install call so one hung step
+    // cannot use up the whole Timeout. Zero means no per-installer limit.
+    InstallerTimeout time.Duration
+    // ContinueOnTimeout keeps going when an installer exceeds InstallerTimeout,
+    // skipping only the installers that depend on it. By default a timeout
+    // stops the run like any other install failure.
+    ContinueOnTimeout bool
+    // ContinueOnError runs every installer whose dependencies succeeded even
+    // after a failure, returning all failures joined together. By default
+    // the run stops after the first stage with a failed install.
+    ContinueOnError bool
+    // Force reinstalls software even if it is already present on the instance
+    Force bool
+    // Completed names installers that already succeeded on the instance, such
+    // as in an earlier run being resumed with ResumeComputeInstance. They are
+    // verified but not run again, and their hooks are skipped.
+    Completed []string
+    // MaxAttempts is how many times an installer is tried when it fails with a
+    // transient error such as a network hiccup. Defaults to DefaultMaxAttempts.
+    MaxAttempts int
+    // VerifyTimeout is how long an installer's Verify keeps being retried,
+    // with backoff, while the service it installed is still starting.
+    // Defaults to DefaultVerifyTimeout. Installers for services known to
+    // start slowly, such as SonarQube and Nexus, allow at least five minutes.
+    VerifyTimeout time.Duration
+    // Output receives the live output of the installers. Defaults to os.Stdout.
+    Output io.Writer
+    // DryRun validates the options and prints the commands each installer
+    // would run, without creating an instance or connecting to one
+    DryRun bool
+    // Installers names the registered installers to run. Empty runs the
+    // default set: jenkins, sonarqube, buildpack and kubernetes.
+    Installers []string
+    // SkipInstallers provisions the instance without running any installer,
+    // ignoring Installers
+    SkipInstallers bool
+    // NoWait returns as soon as Civo accepts the instance, without waiting for
+    // it to become active or running any installer. The details returned only
+    // have the ID, name, status and region set.
+    NoWait bool
+    // Env is exported to every installer's remote commands, e.g. HTTP_PROXY
+    // and HTTPS_PROXY. Values of variables that look like secrets are
+    // redacted in logs and dry-run output.
+    Env map[string]string
+    // InstallerEnv adds environment variables for individual installers,
+    // keyed by installer name, overriding Env
+    InstallerEnv map[string]map[string]string
+    // Configured are installers with their options set, such as
+    // JenkinsInstaller{Plugins: []string{"git"}}, run in place of the
+    // registered installer with the same Name(). They still have to be
+    // selected through Installers, or be part of the default set.
+    Configured []SoftwareInstaller
+    // StartupScript is run by cloud-init when the instance first boots.
+    // Installers start once it has finished.
+    StartupScript string
+    // ConfigureInstance, if set, is called with the instance config after all
+    // other options are applied and just before the instance is created, to
+    // set Civo options that have no field here, such as reverse DNS
+    ConfigureInstance func(*civogo.InstanceConfig)
+    // KeepOnCancel leaves the instance in place when the run is cancelled,
+    // e.g. by Ctrl-C. By default a cancelled run deletes the instance it
+    // created so it is not left half configured.
+    KeepOnCancel bool
+    // Hooks are run around the steps of SetupPipeline and around each installer
+    Hooks Hooks
+    // Progress, if set, receives a ProgressEvent as the pipeline moves through
+    // each phase. Sends block, so the channel must be drained until
+    // CreateComputeInstance returns; it is never closed.
+    Progress chan<- ProgressEvent
+    // Tags are added to the instance alongside DefaultTag, so instances
+    // created by DevOpsMate can be told apart from others in the account
+    Tags []string
+    // FallbackRegions are tried in order when the instance cannot be created
+    // in the requested region because it is out of capacity or unavailable.
+    // Options tied to a region, such as FirewallID, apply to every attempt.
+    FallbackRegions []string
+    // Template is the disk image to boot, given by name (e.g. "ubuntu-jammy"),
+    // label or ID. It must be a Debian or Ubuntu image since the installers use
+    // apt. Defaults to Civo's most recent Ubuntu image.
+    Template string
+    // FirewallID attaches an existing Civo firewall to the instance
+    FirewallID string
+    // FirewallRules creates a firewall for the instance that only allows the
+    // given inbound traffic. The rules must allow the SSH port. Cannot be
+    // combined with FirewallID; with neither, Civo's default firewall is used.
+    FirewallRules []FirewallRule
+    // OpenJenkinsPort adds a rule to the firewall created from FirewallRules
+    // that lets in the Jenkins web UI on port 8080 when the jenkins installer
+    // is selected. It is allowed from the same networks as SSH. Has no effect
+    // without FirewallRules.
+    OpenJenkinsPort bool
+    // SSHKeyID is the Civo SSH key installed on the instance, such as one
+    // returned by GenerateSSHKey. Empty lets Civo set a password instead.
+    SSHKeyID string
+    // SSHKeyPassphrase decrypts the SSH private key when it is passphrase protected
+    SSHKeyPassphrase string
+    // KnownHostsFile enables SSH host key verification against the given
+    // known_hosts file. Empty accepts any host key; setting it is recommended.
+    KnownHostsFile string
+    // SSHPort is the port sshd listens on, for images that move it, e.g. with
+    // StartupScript. Defaults to DefaultSSHPort.
+    SSHPort int
+    // SSHConnectTimeout bounds each attempt to connect to the instance over
+    // SSH. Defaults to DefaultSSHConnectTimeout.
+    SSHConnectTimeout time.Duration
+    // SudoPassword, HomeDir and WorkDir are copied to the InstanceDetails
+    // installers run with; see there
+    SudoPassword string
+    HomeDir      string
+    WorkDir      string
+}
+
+const (
+    // DefaultTag is put on every instance created by CreateComputeInstance
+    DefaultTag = "devopsmate"
+    // DefaultRegion is the Civo region used when none is given
+    DefaultRegion = "LON1"
+    // DefaultPollInterval is the fixed poll interval of status watches and deletes
+    DefaultPollInterval = 5 * time.Second
+    // DefaultInitialPollInterval is the first delay between status checks
+    // while waiting for an instance or cluster to become ready
+    DefaultInitialPollInterval = 2 * time.Second
+    // MaxPollInterval caps the delay between status checks as it backs off
+    MaxPollInterval = 30 * time.Second
+    // DefaultTimeout is the provisioning timeout used when none is set
+    DefaultTimeout = 10 * time.Minute
+    // DefaultMaxAttempts is the number of tries per installer used when none is set
+    DefaultMaxAttempts = 3
+    // DefaultVerifyTimeout is how long Verify is retried when no VerifyTimeout is set
+    DefaultVerifyTimeout = 2 * time.Minute
+
+    // listPageSize is the number of instances requested per page when listing
+    listPageSize = 100
+)
+
+// sshPort returns the SSH port, falling back to DefaultSSHPort
+func (o InstanceOptions) sshPort() int {
+    if o.SSHPort == 0 {
+        return DefaultSSHPort
+    }
+    return o.SSHPort
+}
+
+// installerNames returns the names of the installers selected by the options
+func (o InstanceOptions) installerNames() []string {
+    switch {
+    case o.SkipInstallers:
+        return nil
+    case len(o.Installers) == 0:
+        return defaultInstallers
+    }
+    return o.Installers
+}
+
+// withDefaults returns a copy of the options with unset fields filled in
+func (o InstanceOptions) withDefaults() InstanceOptions {
+    if o.PollInterval <= 0 {
+        o.PollInterval = DefaultInitialPollInterval
+    }
+    if o.Timeout <= 0 {
+        o.Timeout = DefaultTimeout
+    }
+    if o.MaxAttempts <= 0 {
+        o.MaxAttempts = DefaultMaxAttempts
+    }
+    if o.VerifyTimeout <= 0 {
+        o.VerifyTimeout = DefaultVerifyTimeout
+    }
+    return o
+}
+
+// CreateComputeInstance creates a Civo instance, waits for it to become active
+// and installs the selected software on it, all within opts.Timeout. An empty
+// regionCode means DefaultRegion.
+func CreateComputeInstance(apiKey, regionCode, sshKeyPath string, opts InstanceOptions) (InstanceDetails, error) {
+    return CreateComputeInstanceContext(context.Background(), apiKey, regionCode, sshKeyPath, opts)
+}
+
+// CreateComputeInstanceContext is like CreateComputeInstance but stops when ctx
+// is cancelled, deleting the instance unless opts.KeepOnCancel is set
+func CreateComputeInstanceContext(ctx context.Context, apiKey, regionCode, sshKeyPath string, opts InstanceOptions) (InstanceDetails, error) {
+    opts = opts.withDefaults()
+    start := time.Now()
+
+    runCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+    defer cancel()
+
+    details, err := SetupPipeline(runCtx, apiKey, regionCode, sshKeyPath, opts)
+    if !opts.DryRun {
+        provisioningDuration.WithLabelValues(resultLabel(err)).Observe(time.Since(start).Seconds())
+    }
+    // The final event is sent under the caller's context so it still arrives
+    // when the run itself timed out.
+    if err != nil {
+        opts.progress(ctx, PhaseFailed, "", err.Error())
+    } else {
+        opts.progress(ctx, PhaseDone, "", "provisioning finished")
+    }
+    return details, err
+}
+
+// Provision creates a Civo instance and waits until it is active and reachable
+// over SSH. An empty regionCode means DefaultRegion. In dry run nothing is
+// created and placeholder details are returned.
+func Provision(ctx context.Context, apiKey, regionCode, sshKeyPath string, opts InstanceOptions) (InstanceDetails, error) {
+    opts = opts.withDefaults()
+    if regionCode == "" {
+        regionCode = DefaultRegion
+    }
+
+    // Fail before paying for an instance that could never be reached. With
+    // no key at all, installers log in with the password Civo generates.
+    if sshKeyPath != "" || opts.SSHKeyID != "" {
+        if _, err := loadSigner(sshKeyPath, opts.SSHKeyPassphrase); err != nil {
+            return InstanceDetails{}, err
+        }
+    }
+
+    client, err := connectCivo(ctx, apiKey, regionCode)
+    if err != nil {
+        return InstanceDetails{}, err
+    }
+
+    if err := validateRegion(client, regionCode); err != nil {
+        return InstanceDetails{}, err
+    }
+
+    config, err := client.NewInstanceConfig()
+    if err != nil {
+        return InstanceDetails{}, fmt.Errorf("error creating instance config: %w", err)
+    }
+
+    if opts.Size != "" {
+        if err := validateInstanceSize(client, opts.Size); err != nil {
+            return InstanceDetails{}, err
+        }
+        config.Size = opts.Size
+    }
+    config.Tags = instanceTags(opts.Tags)
+    if opts.Template != "" {
+        config.TemplateID, err = resolveTemplate(client, regionCode, opts.Template)
+        if err != nil {
+            return InstanceDetails{}, err
+        }
+    }
+    if opts.SSHKeyID != "" {
+        config.SSHKeyID = opts.SSHKeyID
+    }
+
+    if opts.FirewallID != "" && len(opts.FirewallRules) > 0 {
+        return InstanceDetails{}, errors.New("FirewallID and FirewallRules cannot both be set")
+    }
+    config.FirewallID = opts.FirewallID
+    createdFirewall := ""
+    if len(opts.FirewallRules) > 0 {
+        rules, err := validateFirewallRules(opts.FirewallRules, opts.sshPort())
+        if err != nil {
+            return InstanceDetails{}, err
+        }
+        if opts.OpenJenkinsPort && slices.Contains(opts.installerNames(), "jenkins") {
+            rules = withJenkinsRule(rules, opts.sshPort())
+        }
+        if !opts.DryRun {
+            config.FirewallID, err = createFirewall(client, regionCode, "devopsmate-"+config.Hostname, config.NetworkID, rules)
+            if err != nil {
+                return InstanceDetails{}, err
+            }
+            createdFirewall = config.FirewallID
+        }
+    }
+
+    config.Script = opts.StartupScript
+    if opts.ConfigureInstance != nil {
+        opts.ConfigureInstance(config)
+    }
+
+    if opts.DryRun {
+        return InstanceDetails{Region: regionCode, SSHKey: sshKeyPath, SSHKeyPassphrase: opts.SSHKeyPassphrase, KnownHostsFile: opts.KnownHostsFile, SSHPort: opts.SSHPort, SSHConnectTimeout: opts.SSHConnectTimeout, Output: opts.Output, SudoPassword: opts.SudoPassword, HomeDir: opts.HomeDir, WorkDir: opts.WorkDir, DryRun: true}, nil
+    }
+    details, err := provisionInstance(ctx, client, config, sshKeyPath, opts)
+    if details.ID != "" {
+        details.Region = regionCode
+        details.FirewallID = createdFirewall
+    } else if err != nil && createdFirewall != "" {
+        // No instance means nothing else will ever clean up the firewall. If
+        // it cannot be deleted, it is reported so the caller can retry.
+        if delErr := deleteFirewall(client, createdFirewall); delErr != nil {
+            details.Region = regionCode
+            details.FirewallID = createdFirewall
+            err = errors.Join(err, delErr)
+        }
+    }
+    return details, err
+}
+
+// provisionWithFailover calls Provision in regionCode, then in each of
+// opts.FallbackRegions in turn while creation fails for lack of capacity.
+// It only moves on once the failed region is left clean: Provision deletes
+// the devopsmate-<hostname> firewall it made there, and if that fails the
+// failover stops with the firewall in the returned details. The details
+// returned record the region that was used.
+func provisionWithFailover(ctx context.Context, apiKey, regionCode, sshKeyPath string, opts InstanceOptions) (InstanceDetails, error) {
+    if regionCode == "" {
+        regionCode = DefaultRegion
+    }
+    regions := append([]string{regionCode}, opts.FallbackRegions...)
+
+    var errs []error
+    for i, region := range regions {
+        details, err := Provision(ctx, apiKey, region, sshKeyPath, opts)
+        if err == nil || details.ID != "" || details.FirewallID != "" || !isCapacityError(err) {
+            if err != nil && len(errs) > 0 {
+                err = errors.Join(append(errs, fmt.Errorf("region %s: %w", region, err))...)
+            }
+            return details, err
+        }
+        errs = append(errs, fmt.Errorf("region %s: %w", region, err))
+        if i+1 < len(regions) {
+            slog.Warn("region cannot take the instance, trying the next", "region", region, "next", regions[i+1], "err", err)
+        }
+    }
+    return InstanceDetails{}, errors.Join(errs...)
+}
+
+// isCapacityError reports whether err means the region cannot take the
+// instance right now, so another region may succeed
+func isCapacityError(err error) bool {
+    return errors.Is(err, civogo.OutOFCapacityError) || errors.Is(err, civogo.RegionUnavailableError)
+}
+
+// Install runs the installers selected by opts on an instance returned by
+// Provision, recording their outputs and results on the returned details.
+// apiKey and regionCode are passed to installers that call the Civo API.
+func Install(ctx context.Context, apiKey, regionCode string, instance InstanceDetails, opts InstanceOptions) (InstanceDetails, error) {
+    opts = opts.withDefaults()
+    if regionCode == "" {
+        regionCode = DefaultRegion
+    }
+
+    if opts.SkipInstallers {
+        return instance, nil
+    }
+    if err := opts.validateEnv(); err != nil {
+        return instance, err
+    }
+    installers, err := opts.lookupInstallers(opts.installerNames())
+    if err != nil {
+        return instance, err
+    }
+    for i, installer := range installers {
+        installers[i] = WithCivoCredentials(installer, apiKey, regionCode)
+    }
+
+    var clusterMu sync.Mutex
+    cluster := instance.KubernetesCluster
+    instance.clusterCreated = func(name string) {
+        clusterMu.Lock()
+        defer clusterMu.Unlock()
+        cluster = name
+    }
+    instance.Outputs, instance.Results, err = runInstallers(ctx, instance, installers, opts)
+    instance.clusterCreated = nil
+    instance.KubernetesCluster = cluster
+    if !instance.DryRun {
+        recordInstallResults(instance.Results)
+    }
+    return instance, err
+}
+
+// provisionInstance creates the instance and waits until it is active and
+// reachable over SSH
+func provisionInstance(ctx context.Context, client civoClient, config *civogo.InstanceConfig, sshKeyPath string, opts InstanceOptions) (InstanceDetails, error) {
+    slog.Info("creating instance", "hostname", config.Hostname, "size", config.Size, "region", config.Region)
+    opts.progress(ctx, PhaseCreating, "", "creating instance "+config.Hostname)
+    instance, err := client.CreateInstance(config)
+    if err != nil {
+        return InstanceDetails{}, fmt.Errorf("error creating instance: %w", err)
+    }
+    instancesCreated.Inc()
+    if opts.NoWait {
+        slog.Info("not waiting for instance to become active", "id", instance.ID)
+        return InstanceDetails{ID: instance.ID, Name: instance.Hostname, Status: instance.Status, Tags: instance.Tags}, nil
+    }
+    slog.Info("waiting for instance to become active", "id", instance.ID)
+    opts.progress(ctx, PhasePolling, "", "waiting for instance "+instance.ID+" to become active")
+
+    ready := make(chan InstanceDetails, 1)
+    failed := make(chan error, 1)
+    go func() {
+        interval := opts.PollInterval
+        limited := 0
+        for {
+            inst, err := client.GetInstance(instance.ID)
+            if err != nil {
+                slog.Debug("error polling instance status", "id", instance.ID, "err", err)
+            } else {
+                slog.Debug("polled instance status", "id", instance.ID, "status", inst.Status)
+            }
+            if isRateLimited(err) {
+                limited++
+                if limited >= rateLimitAttempts {
+                    failed <- fmt.Errorf("%w while waiting for instance %s to become active: %w", ErrRateLimited, instance.ID, err)
+                    return
+                }
+                slog.Warn("Civo API rate limit hit, backing off", "id", instance.ID, "retry_in", max(interval, rateLimitBackoff))
+                interval = max(interval, rateLimitBackoff)
+            } else {
+                limited = 0
+            }
+            switch {
+            case errors.Is(err, civogo.DatabaseInstanceNotFoundError):
+                failed <- fmt.Errorf("instance %s was deleted while waiting for it to become active", instance.ID)
+                return
+            case err == nil && inst.Status == "ACTIVE":
+                ready <- activeInstanceDetails(inst, sshKeyPath, opts)
+                return
+            case err == nil && isTerminalStatus(inst.Status):
+                failed <- fmt.Errorf("instance %s entered terminal status %s", instance.ID, inst.Status)
+                return
+            }
+
+            select {
+            case <-ctx.Done():
+                return
+            case <-time.After(interval):
+            }
+            interval = nextPollInterval(interval)
+        }
+    }()
+
+    // Failures still report which instance was created so the caller can
+    // inspect or delete it.
+    created := InstanceDetails{ID: instance.ID, Name: instance.Hostname}
+
+    var details InstanceDetails
+    select {
+    case details = <-ready:
+    case err := <-failed:
+        return created, err
+    case <-ctx.Done():
+        if errors.Is(ctx.Err(), context.Canceled) {
+            return created, fmt.Errorf("cancelled while waiting for instance %s to become active: %w", instance.ID, ctx.Err())
+        }
+        return created, fmt.Errorf("%w %s to become active after %s", ErrInstanceTimeout, instance.ID, opts.Timeout)
+    }
+
+    slog.Info("instance is active", "id", instance.ID, "public_ip", details.PublicIP)
+
+    if err := waitForSSH(ctx, details); err != nil {
+        return details, err
+    }
+    opts.progress(ctx, PhaseSSHReady, "", "instance "+details.PublicIP+" is reachable over SSH")
+
+    if opts.StartupScript != "" {
+        // Let the startup script finish so it does not race the installers,
+        // e.g. for the apt lock.
+        slog.Info("waiting for startup script to finish", "id", instance.ID)
+        if _, err := readRemoteCommand(ctx, details, "cloud-init status --wait"); err != nil {
+            slog.Warn("startup script did not finish cleanly", "id", instance.ID, "err", err)
+        }
+    }
+    return details, nil
+}
+
+// activeInstanceDetails returns the connection details of an active instance
+func activeInstanceDetails(inst *civogo.Instance, sshKeyPath string, opts InstanceOptions) InstanceDetails {
+    return InstanceDetails{
+        ID:                inst.ID,
+        Name:              inst.Hostname,
+        Status:            inst.Status,
+        Tags:              inst.Tags,
+        PublicIP:          inst.PublicIP,
+        Password:          inst.InitialPassword,
+        SSHKey:            sshKeyPath,
+        SSHKeyPassphrase:  opts.SSHKeyPassphrase,
+        KnownHostsFile:    opts.KnownHostsFile,
+        SSHUser:           inst.InitialUser,
+        SSHPort:           opts.SSHPort,
+        SSHConnectTimeout: opts.SSHConnectTimeout,
+        Output:            opts.Output,
+        SudoPassword:      opts.SudoPassword,
+        HomeDir:           opts.HomeDir,
+        WorkDir:           opts.WorkDir,
+    }
+}
+
+// nextPollInterval doubles a polling delay, capping it at MaxPollInterval.
+// Delays already above the cap are left alone.
+func nextPollInterval(d time.Duration) time.Duration {
+    if d >= MaxPollInterval {
+        return d
+    }
+    return min(2*d, MaxPollInterval)
+}
+
+// isTerminalStatus reports whether an instance status means it will never become active
+func isTerminalStatus(status string) bool {
+    switch strings.ToUpper(status) {
+    case "FAILED", "ERROR", "DELETED", "DELETING", "KILLED":
+        return true
+    }
+    return false
+}
+
+// validateRegion checks that code is one of the regions offered by Civo
+func validateRegion(client civoClient, code string) error {
+    regions, err := client.ListRegions()
+    if err != nil {
+        return fmt.Errorf("error listing regions: %w", err)
+    }
+
+    codes := make([]string, 0, len(regions))
+    for _, r := range regions {
+        if strings.EqualFold(r.Code, code) {
+            return nil
+        }
+        codes = append(codes, r.Code)
+    }
+    return fmt.Errorf("unknown region %q, valid regions are: %s", code, strings.Join(codes, ", "))
+}
+
+// validateInstanceSize checks that size is one of the sizes offered by Civo
+func validateInstanceSize(client civoClient, size string) error {
+    sizes, err := client.ListInstanceSizes()
+    if err != nil {
+        return fmt.Errorf("error listing instance sizes: %w", err)
+    }
+
+    for _, s := range sizes {
+        if s.Name == size {
+            return nil
+        }
+    }
+    return fmt.Errorf("unknown instance size %q", size)
+}
+
+// instanceTags returns DefaultTag followed by tags, without duplicates or blanks
+func instanceTags(tags []string) []string {
+    all := []string{DefaultTag}
+    for _, tag := range tags {
+        tag = strings.TrimSpace(tag)
+        if tag != "" && !slices.Contains(all, tag) {
+            all = append(all, tag)
+        }
+    }
+    return all
+}
+
+// aptDistributions are the image distributions the installers' apt scripts support
+var aptDistributions = []string{"ubuntu", "debian"}
+
+// resolveTemplate returns the ID of the disk image whose name, label or ID is
+// template, checking that it is a distribution the installers support
+func resolveTemplate(client civoClient, regionCode, template string) (string, error) {
+    images, err := client.ListDiskImages()
+    if err != nil {
+        return "", fmt.Errorf("error listing disk images: %w", err)
+    }
+
+    names := make([]string, 0, len(images))
+    for _, image := range images {
+        if image.ID != template && !strings.EqualFold(image.Name, template) && !strings.EqualFold(image.Label, template) {
+            names = append(names, image.Name)
+            continue
+        }
+        if !slices.Contains(aptDistributions, strings.ToLower(image.Distribution)) {
+            return "", fmt.Errorf("disk image %s is %s, but the installers only support %s", image.Name, image.Distribution, strings.Join(aptDistributions, " and "))
+        }
+        return image.ID, nil
+    }
+    return "", fmt.Errorf("unknown disk image %q in region %s, valid images are: %s", template, regionCode, strings.Join(names, ", "))
+}
+
+// DestroyComputeInstance deletes the Civo instance with the given ID
+func DestroyComputeInstance(apiKey, regionCode, instanceID string) error {
+    client, err := connectCivo(context.Background(), apiKey, regionCode)
+    if err != nil {
+        return err
+    }
+    return deleteInstance(client, instanceID)
+}
+
+// DestroyComputeInstanceAndWait deletes the Civo instance with the given ID and
+// waits until Civo no longer reports it, or the timeout expires.
+func DestroyComputeInstanceAndWait(apiKey, regionCode, instanceID string, timeout time.Duration) error {
+    client, err := connectCivo(context.Background(), apiKey, regionCode)
+    if err != nil {
+        return err
+    }
+
+    if err := deleteInstance(client, instanceID); err != nil {
+        return err
+    }
+    return waitForInstanceDeletion(client, instanceID, timeout)
+}
+
+// waitForInstanceDeletion polls until Civo no longer reports the instance, or
+// the timeout expires
+func waitForInstanceDeletion(client civoClient, instanceID string, timeout time.Duration) error {
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+
+    for {
+        _, err := client.GetInstance(instanceID)
+        if errors.Is(err, civogo.DatabaseInstanceNotFoundError) {
+            return nil
+        }
+
+        select {
+        case <-ctx.Done():
+            return fmt.Errorf("%w %s to be deleted after %s", ErrInstanceTimeout, instanceID, timeout)
+        case <-time.After(DefaultPollInterval):
+        }
+    }
+}
+
+// deleteInstance asks Civo to delete the instance
+func deleteInstance(client civoClient, instanceID string) error {
+    if _, err := client.DeleteInstance(instanceID); err != nil {
+        return fmt.Errorf("error deleting instance %s: %w", instanceID, err)
+    }
+    return nil
+}
+
+// GetComputeInstance returns the current state of the instance with the given ID
+func GetComputeInstance(apiKey, regionCode, instanceID string) (InstanceDetails, error) {
+    client, err := connectCivo(context.Background(), apiKey, regionCode)
+    if err != nil {
+        return InstanceDetails{}, err
+    }
+
+    inst, err := client.GetInstance(instanceID)
+    if err != nil {
+        return InstanceDetails{}, fmt.Errorf("error getting instance %s: %w", instanceID, err)
+    }
+    return InstanceDetails{
+        ID:       inst.ID,
+        Name:     inst.Hostname,
+        Status:   inst.Status,
+        PublicIP: inst.PublicIP,
+        Tags:     inst.Tags,
+        SSHUser:  inst.InitialUser,
+    }, nil
+}
+
+// ListComputeInstances returns every instance in the region owned by the account
+func ListComputeInstances(apiKey, regionCode string) ([]InstanceDetails, error) {
+    client, err := connectCivo(context.Background(), apiKey, regionCode)
+    if err != nil {
+        return nil, err
+    }
+    return listInstances(client)
+}
+
+// InstancesWithTag returns the instances in the region that carry tag
+func InstancesWithTag(apiKey, regionCode, tag string) ([]InstanceDetails, error) {
+    client, err := connectCivo(context.Background(), apiKey, regionCode)
+    if err != nil {
+        return nil, err
+    }
+    return instancesWithTag(client, tag)
+}
+
+// DestroyByTag deletes every instance in the region that carries tag and
+// returns the IDs of those it deleted. A failure to delete one instance does
+// not stop the others; the failures are returned together.
+func DestroyByTag(apiKey, regionCode, tag string) ([]string, error) {
+    if tag == "" {
+        return nil, errors.New("no tag given")
+    }
+    client, err := connectCivo(context.Background(), apiKey, regionCode)
+    if err != nil {
+        return nil, err
+    }
+    instances, err := instancesWithTag(client, tag)
+    if err != nil {
+        return nil, err
+    }
+
+    var deleted []string
+    var errs []error
+    for _, inst := range instances {
+        if err := deleteInstance(client, inst.ID); err != nil {
+            errs = append(errs, err)
+            continue
+        }
+        slog.Info("instance destroyed", "id", inst.ID, "name", inst.Name)
+        deleted = append(deleted, inst.ID)
+    }
+    return deleted, errors.Join(errs...)
+}
+
+// instancesWithTag returns the instances that carry tag
+func instancesWithTag(client civoClient, tag string) ([]InstanceDetails, error) {
+    instances, err := listInstances(client)
+    if err != nil {
+        return nil, err
+    }
+    var tagged []InstanceDetails
+    for _, inst := range instances {
+        if slices.Contains(inst.Tags, tag) {
+            tagged = append(tagged, inst)
+        }
+    }
+    return tagged, nil
+}
+
+// listInstances returns every instance in the client's region, reading all pages
+func listInstances(client civoClient) ([]InstanceDetails, error) {
+    var instances []InstanceDetails
+    for page := 1; ; page++ {
+        list, err := client.ListInstances(page, listPageSize)
+        if err != nil {
+            return nil, fmt.Errorf("error listing instances: %w", err)
+        }
+
+        for _, inst := range list.Items {
+            instances = append(instances, InstanceDetails{
+                ID:       inst.ID,
+                Name:     inst.Hostname,
+                Status:   inst.Status,
+                PublicIP: inst.PublicIP,
+                Tags:     inst.Tags,
+            })
+        }
+
+        if page >= list.Pages {
+            break
+        }
+    }
+    return instances, nil
+}
@@ -0,0 +1,408 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "slices"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/civo/civogo"
+)
+
+// fakeCivo is a civoClient standing in for the Civo API in one region
+type fakeCivo struct {
+    mu sync.Mutex
+
+    region string
+    // createErr is returned by CreateInstance
+    createErr error
+    // getErrs are returned by the first calls to GetInstance, one each
+    getErrs []error
+    // statuses are reported by GetInstance in turn once getErrs run out, the
+    // last one repeating. Defaults to ACTIVE.
+    statuses []string
+    // deleteFirewallErr is returned by DeleteFirewall
+    deleteFirewallErr error
+    // deleteErrs are returned by DeleteInstance for the given IDs
+    deleteErrs map[string]error
+    // instances are listed by ListInstances
+    instances []civogo.Instance
+
+    created          []*civogo.InstanceConfig
+    gets             int
+    firewalls        []string
+    deletedFirewalls []string
+    deleted          []string
+}
+
+func (f *fakeCivo) ListRegions() ([]civogo.Region, error) {
+    return []civogo.Region{{Code: f.region}}, nil
+}
+
+func (f *fakeCivo) ListInstanceSizes() ([]civogo.InstanceSize, error) { return nil, nil }
+
+func (f *fakeCivo) ListDiskImages() ([]civogo.DiskImage, error) { return nil, nil }
+
+func (f *fakeCivo) NewFirewall(config *civogo.FirewallConfig) (*civogo.FirewallResult, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    id := fmt.Sprintf("fw-%s-%d", f.region, len(f.firewalls)+1)
+    f.firewalls = append(f.firewalls, id)
+    return &civogo.FirewallResult{ID: id, Name: config.Name}, nil
+}
+
+func (f *fakeCivo) DeleteFirewall(id string) (*civogo.SimpleResponse, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if f.deleteFirewallErr != nil {
+        return nil, f.deleteFirewallErr
+    }
+    f.deletedFirewalls = append(f.deletedFirewalls, id)
+    return &civogo.SimpleResponse{Result: "success"}, nil
+}
+
+func (f *fakeCivo) NewInstanceConfig() (*civogo.InstanceConfig, error) {
+    return &civogo.InstanceConfig{Hostname: "test-host", Region: f.region}, nil
+}
+
+func (f *fakeCivo) CreateInstance(config *civogo.InstanceConfig) (*civogo.Instance, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.created = append(f.created, config)
+    if f.createErr != nil {
+        return nil, f.createErr
+    }
+    return &civogo.Instance{ID: "inst-" + f.region, Hostname: config.Hostname, Status: "BUILDING"}, nil
+}
+
+func (f *fakeCivo) GetInstance(id string) (*civogo.Instance, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.gets++
+    if len(f.getErrs) > 0 {
+        err := f.getErrs[0]
+        f.getErrs = f.getErrs[1:]
+        return nil, err
+    }
+    status := "ACTIVE"
+    if len(f.statuses) > 0 {
+        status = f.statuses[0]
+        if len(f.statuses) > 1 {
+            f.statuses = f.statuses[1:]
+        }
+    }
+    return &civogo.Instance{
+        ID:              id,
+        Hostname:        "test-host",
+        Status:          status,
+        PublicIP:        "127.0.0.1",
+        InitialUser:     "civo",
+        InitialPassword: "generated",
+    }, nil
+}
+
+func (f *fakeCivo) ListInstances(page, perPage int) (*civogo.PaginatedInstanceList, error) {
+    start := min((page-1)*perPage, len(f.instances))
+    end := min(start+perPage, len(f.instances))
+    pages := max((len(f.instances)+perPage-1)/perPage, 1)
+    return &civogo.PaginatedInstanceList{Page: page, PerPage: perPage, Pages: pages, Items: f.instances[start:end]}, nil
+}
+
+func (f *fakeCivo) DeleteInstance(id string) (*civogo.SimpleResponse, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if err := f.deleteErrs[id]; err != nil {
+        return nil, err
+    }
+    f.deleted = append(f.deleted, id)
+    return &civogo.SimpleResponse{Result: "success"}, nil
+}
+
+// useFakeCivo makes connectCivo return the fake for each region
+func useFakeCivo(t *testing.T, fakes ...*fakeCivo) {
+    t.Helper()
+    orig := connectCivo
+    connectCivo = func(ctx context.Context, apiKey, regionCode string) (civoClient, error) {
+        for _, f := range fakes {
+            if f.region == regionCode {
+                return f, nil
+            }
+        }
+        return nil, fmt.Errorf("no fake client for region %s", regionCode)
+    }
+    t.Cleanup(func() { connectCivo = orig })
+}
+
+// listenSSH accepts TCP connections on a local port for the fake instances to
+// be reachable on, returning the port
+func listenSSH(t *testing.T) int {
+    t.Helper()
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { l.Close() })
+    go func() {
+        for {
+            conn, err := l.Accept()
+            if err != nil {
+                return
+            }
+            conn.Close()
+        }
+    }()
+    return l.Addr().(*net.TCPAddr).Port
+}
+
+// testOptions returns options that poll quickly and reach the fake instance on port
+func testOptions(port int) InstanceOptions {
+    return InstanceOptions{PollInterval: time.Millisecond, SSHPort: port, Output: io.Discard}
+}
+
+func TestProvision(t *testing.T) {
+    port := listenSSH(t)
+    fake := &fakeCivo{region: "LON1", statuses: []string{"BUILDING", "BUILDING", "ACTIVE"}}
+    useFakeCivo(t, fake)
+
+    opts := testOptions(port)
+    opts.Tags = []string{"ci"}
+    details, err := Provision(context.Background(), "key", "LON1", "", opts)
+    if err != nil {
+        t.Fatalf("Provision: %v", err)
+    }
+
+    if details.ID != "inst-LON1" || details.Region != "LON1" || details.PublicIP != "127.0.0.1" {
+        t.Errorf("got ID %q region %q IP %q, want inst-LON1, LON1, 127.0.0.1", details.ID, details.Region, details.PublicIP)
+    }
+    if details.SSHUser != "civo" || details.Password != "generated" {
+        t.Errorf("got user %q password %q, want the instance's initial ones", details.SSHUser, details.Password)
+    }
+    if fake.gets != 3 {
+        t.Errorf("polled %d times, want 3", fake.gets)
+    }
+    if len(fake.created) != 1 {
+        t.Fatalf("created %d instances, want 1", len(fake.created))
+    }
+    if tags := fake.created[0].Tags; !slices.Equal(tags, []string{DefaultTag, "ci"}) {
+        t.Errorf("got tags %v, want [%s ci]", tags, DefaultTag)
+    }
+}
+
+func TestProvisionPolling(t *testing.T) {
+    port := listenSSH(t)
+    tests := []struct {
+        name     string
+        statuses []string
+        timeout  time.Duration
+        wantErr  string
+        wantIs   error
+    }{
+        {name: "active", statuses: []string{"BUILDING", "ACTIVE"}},
+        {name: "error", statuses: []string{"BUILDING", "ERROR"}, wantErr: "terminal status ERROR"},
+        {name: "timeout", statuses: []string{"BUILDING"}, timeout: 50 * time.Millisecond, wantIs: ErrInstanceTimeout},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            fake := &fakeCivo{region: "LON1", statuses: tt.statuses}
+            useFakeCivo(t, fake)
+
+            ctx := context.Background()
+            if tt.timeout > 0 {
+                var cancel context.CancelFunc
+                ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+                defer cancel()
+            }
+            details, err := Provision(ctx, "key", "LON1", "", testOptions(port))
+
+            switch {
+            case tt.wantErr == "" && tt.wantIs == nil:
+                if err != nil {
+                    t.Fatalf("Provision: %v", err)
+                }
+            case err == nil:
+                t.Fatal("Provision succeeded, want an error")
+            case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+                t.Errorf("got error %q, want it to contain %q", err, tt.wantErr)
+            case tt.wantIs != nil && !errors.Is(err, tt.wantIs):
+                t.Errorf("got error %q, want %v", err, tt.wantIs)
+            }
+            if details.ID != "inst-LON1" {
+                t.Errorf("got ID %q, want the created instance reported even on failure", details.ID)
+            }
+        })
+    }
+}
+
+func TestProvisionRateLimit(t *testing.T) {
+    port := listenSSH(t)
+    orig := rateLimitBackoff
+    rateLimitBackoff = 20 * time.Millisecond
+    t.Cleanup(func() { rateLimitBackoff = orig })
+    limited := civogo.HTTPError{Code: http.StatusTooManyRequests, Status: "429 Too Many Requests"}
+
+    t.Run("backs off and recovers", func(t *testing.T) {
+        fake := &fakeCivo{region: "LON1", getErrs: []error{limited, limited}}
+        useFakeCivo(t, fake)
+
+        start := time.Now()
+        if _, err := Provision(context.Background(), "key", "LON1", "", testOptions(port)); err != nil {
+            t.Fatalf("Provision: %v", err)
+        }
+        if elapsed := time.Since(start); elapsed < 2*rateLimitBackoff {
+            t.Errorf("took %s, want at least %s of backoff", elapsed, 2*rateLimitBackoff)
+        }
+        if fake.gets != 3 {
+            t.Errorf("polled %d times, want 3", fake.gets)
+        }
+    })
+
+    t.Run("gives up", func(t *testing.T) {
+        errs := make([]error, rateLimitAttempts+5)
+        for i := range errs {
+            errs[i] = limited
+        }
+        fake := &fakeCivo{region: "LON1", getErrs: errs}
+        useFakeCivo(t, fake)
+
+        _, err := Provision(context.Background(), "key", "LON1", "", testOptions(port))
+        if !errors.Is(err, ErrRateLimited) {
+            t.Fatalf("got error %v, want ErrRateLimited", err)
+        }
+        if fake.gets != rateLimitAttempts {
+            t.Errorf("polled %d times, want %d", fake.gets, rateLimitAttempts)
+        }
+    })
+}
+
+func TestProvisionDeletesFirewallWithoutInstance(t *testing.T) {
+    port := listenSSH(t)
+    fake := &fakeCivo{region: "LON1", createErr: errors.New("quota exceeded")}
+    useFakeCivo(t, fake)
+
+    opts := testOptions(port)
+    opts.FirewallRules = []FirewallRule{{StartPort: port}}
+    details, err := Provision(context.Background(), "key", "LON1", "", opts)
+    if err == nil {
+        t.Fatal("Provision succeeded, want an error")
+    }
+    if !slices.Equal(fake.deletedFirewalls, fake.firewalls) || len(fake.firewalls) != 1 {
+        t.Errorf("created firewalls %v, deleted %v, want the one created deleted", fake.firewalls, fake.deletedFirewalls)
+    }
+    if details.FirewallID != "" {
+        t.Errorf("got firewall %q, want none left", details.FirewallID)
+    }
+}
+
+func TestProvisionWithFailover(t *testing.T) {
+    port := listenSSH(t)
+
+    t.Run("moves on when out of capacity", func(t *testing.T) {
+        lon := &fakeCivo{region: "LON1", createErr: civogo.OutOFCapacityError}
+        fra := &fakeCivo{region: "FRA1", createErr: civogo.RegionUnavailableError}
+        nyc := &fakeCivo{region: "NYC1"}
+        useFakeCivo(t, lon, fra, nyc)
+
+        opts := testOptions(port)
+        opts.FallbackRegions = []string{"FRA1", "NYC1"}
+        opts.FirewallRules = []FirewallRule{{StartPort: port}}
+        details, err := provisionWithFailover(context.Background(), "key", "LON1", "", opts)
+        if err != nil {
+            t.Fatalf("provisionWithFailover: %v", err)
+        }
+        if details.Region != "NYC1" || details.ID != "inst-NYC1" {
+            t.Errorf("got region %q ID %q, want NYC1 and inst-NYC1", details.Region, details.ID)
+        }
+        for _, f := range []*fakeCivo{lon, fra} {
+            if len(f.firewalls) != 1 || !slices.Equal(f.deletedFirewalls, f.firewalls) {
+                t.Errorf("%s: created firewalls %v, deleted %v, want them cleaned up", f.region, f.firewalls, f.deletedFirewalls)
+            }
+        }
+        if len(nyc.deletedFirewalls) != 0 || details.FirewallID != nyc.firewalls[0] {
+            t.Errorf("got firewall %q, deleted %v, want %s kept", details.FirewallID, nyc.deletedFirewalls, nyc.firewalls[0])
+        }
+    })
+
+    t.Run("stops on other errors", func(t *testing.T) {
+        lon := &fakeCivo{region: "LON1", createErr: errors.New("invalid size")}
+        nyc := &fakeCivo{region: "NYC1"}
+        useFakeCivo(t, lon, nyc)
+
+        opts := testOptions(port)
+        opts.FallbackRegions = []string{"NYC1"}
+        if _, err := provisionWithFailover(context.Background(), "key", "LON1", "", opts); err == nil {
+            t.Fatal("provisionWithFailover succeeded, want an error")
+        }
+        if len(nyc.created) != 0 {
+            t.Error("tried NYC1 after an error that was not about capacity")
+        }
+    })
+
+    t.Run("stops when a firewall is left behind", func(t *testing.T) {
+        lon := &fakeCivo{region: "LON1", createErr: civogo.OutOFCapacityError, deleteFirewallErr: errors.New("API down")}
+        nyc := &fakeCivo{region: "NYC1"}
+        useFakeCivo(t, lon, nyc)
+
+        opts := testOptions(port)
+        opts.FallbackRegions = []string{"NYC1"}
+        opts.FirewallRules = []FirewallRule{{StartPort: port}}
+        details, err := provisionWithFailover(context.Background(), "key", "LON1", "", opts)
+        if err == nil {
+            t.Fatal("provisionWithFailover succeeded, want an error")
+        }
+        if details.FirewallID != lon.firewalls[0] || details.Region != "LON1" {
+            t.Errorf("got firewall %q in %q, want %s in LON1 reported", details.FirewallID, details.Region, lon.firewalls[0])
+        }
+        if len(nyc.created) != 0 {
+            t.Error("tried NYC1 while LON1 still had a firewall")
+        }
+    })
+
+    t.Run("reports every region", func(t *testing.T) {
+        lon := &fakeCivo{region: "LON1", createErr: civogo.OutOFCapacityError}
+        nyc := &fakeCivo{region: "NYC1", createErr: civogo.OutOFCapacityError}
+        useFakeCivo(t, lon, nyc)
+
+        opts := testOptions(port)
+        opts.FallbackRegions = []string{"NYC1"}
+        _, err := provisionWithFailover(context.Background(), "key", "LON1", "", opts)
+        if err == nil || !strings.Contains(err.Error(), "region LON1") || !strings.Contains(err.Error(), "region NYC1") {
+            t.Errorf("got error %v, want both regions reported", err)
+        }
+    })
+}
+
+func TestDestroyByTag(t *testing.T) {
+    fake := &fakeCivo{
+        region:     "LON1",
+        deleteErrs: map[string]error{"b": errors.New("locked")},
+    }
+    // More than a page, so every page has to be read
+    for i := 0; i < listPageSize+2; i++ {
+        fake.instances = append(fake.instances, civogo.Instance{ID: fmt.Sprintf("other-%d", i), Tags: []string{"other"}})
+    }
+    fake.instances = append(fake.instances,
+        civogo.Instance{ID: "a", Tags: []string{DefaultTag, "ci"}},
+        civogo.Instance{ID: "b", Tags: []string{"ci"}},
+        civogo.Instance{ID: "c", Tags: []string{"ci"}},
+    )
+    useFakeCivo(t, fake)
+
+    deleted, err := DestroyByTag("key", "LON1", "ci")
+    if err == nil || !strings.Contains(err.Error(), "locked") {
+        t.Errorf("got error %v, want the failure to delete b", err)
+    }
+    if !slices.Equal(deleted, []string{"a", "c"}) || !slices.Equal(fake.deleted, []string{"a", "c"}) {
+        t.Errorf("reported %v and deleted %v, want [a c]", deleted, fake.deleted)
+    }
+
+    if _, err := DestroyByTag("key", "LON1", ""); err == nil {
+        t.Error("DestroyByTag with no tag succeeded, want an error")
+    }
+}
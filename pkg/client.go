@@ -0,0 +1,147 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/civo/civogo"
+)
+
+const (
+    // clientAttempts is how many times newCivoClient tries to reach the API
+    clientAttempts = 4
+    // clientBackoff is the delay before newCivoClient's first retry
+    clientBackoff = time.Second
+    // rateLimitAttempts is how many rate-limited responses in a row a status
+    // poll tolerates before giving up with ErrRateLimited
+    rateLimitAttempts = 5
+)
+
+// rateLimitBackoff is the delay after the API rejects a request for exceeding
+// its rate limit, longer than a normal retry to let it recover. It is a
+// variable so that tests can shorten it.
+var rateLimitBackoff = MaxPollInterval
+
+// ErrRateLimited is returned, wrapped, when the Civo API keeps rejecting
+// requests for exceeding its rate limit. Callers can check for it with
+// errors.Is and slow down before trying again.
+var ErrRateLimited = errors.New("Civo API rate limit exceeded")
+
+// civoClient is the part of the civogo client used to provision and manage
+// instances. Provisioning depends on it rather than on *civogo.Client so that
+// a fake can stand in for the Civo API.
+type civoClient interface {
+    ListRegions() ([]civogo.Region, error)
+    ListInstanceSizes() ([]civogo.InstanceSize, error)
+    ListDiskImages() ([]civogo.DiskImage, error)
+    NewFirewall(config *civogo.FirewallConfig) (*civogo.FirewallResult, error)
+    DeleteFirewall(id string) (*civogo.SimpleResponse, error)
+    NewInstanceConfig() (*civogo.InstanceConfig, error)
+    CreateInstance(config *civogo.InstanceConfig) (*civogo.Instance, error)
+    GetInstance(id string) (*civogo.Instance, error)
+    ListInstances(page, perPage int) (*civogo.PaginatedInstanceList, error)
+    DeleteInstance(id string) (*civogo.SimpleResponse, error)
+}
+
+var _ civoClient = (*civogo.Client)(nil)
+
+// connectCivo returns the client used by Provision and the instance
+// functions. It is a variable so that a fake client can be injected.
+var connectCivo = func(ctx context.Context, apiKey, regionCode string) (civoClient, error) {
+    client, err := newCivoClient(ctx, apiKey, regionCode)
+    if err != nil {
+        return nil, err
+    }
+    return client, nil
+}
+
+// newCivoClient creates a Civo client and checks that the API is reachable and
+// accepts the key. Network failures are retried with exponential backoff until
+// clientAttempts is reached or ctx is done; authentication failures are
+// returned at once since retrying cannot fix them.
+func newCivoClient(ctx context.Context, apiKey, regionCode string) (*civogo.Client, error) {
+    client, err := civogo.NewClient(apiKey, regionCode)
+    if err != nil {
+        return nil, fmt.Errorf("error creating Civo client: %w", err)
+    }
+
+    backoff := clientBackoff
+    for attempt := 1; ; attempt++ {
+        _, err := client.ListRegions()
+        switch {
+        case err == nil:
+            return client, nil
+        case isAuthError(err):
+            return nil, fmt.Errorf("%w: %w", ErrAuth, err)
+        case isRateLimited(err) && attempt >= clientAttempts:
+            return nil, fmt.Errorf("error connecting to the Civo API: %w: %w", ErrRateLimited, err)
+        case !isRateLimited(err) && (!isNetworkError(err) || attempt >= clientAttempts):
+            return nil, fmt.Errorf("error connecting to the Civo API: %w", err)
+        }
+
+        wait := backoff
+        if isRateLimited(err) {
+            wait = max(backoff, rateLimitBackoff)
+            slog.Warn("Civo API rate limit hit, backing off", "attempt", attempt, "retry_in", wait)
+        } else {
+            slog.Warn("Civo API unreachable, retrying", "attempt", attempt, "retry_in", wait, "err", err)
+        }
+
+        select {
+        case <-ctx.Done():
+            return nil, fmt.Errorf("error connecting to the Civo API: %w", errors.Join(err, ctx.Err()))
+        case <-time.After(wait):
+        }
+        backoff *= 2
+    }
+}
+
+// isAuthError reports whether err means the API key is missing, invalid or
+// not allowed to make the request
+func isAuthError(err error) bool {
+    for _, target := range []error{
+        civogo.NoAPIKeySuppliedError,
+        civogo.AuthenticationError,
+        civogo.AuthenticationFailedError,
+        civogo.AuthenticationInvalidKeyError,
+        civogo.AuthenticationAccessDeniedError,
+    } {
+        if errors.Is(err, target) {
+            return true
+        }
+    }
+    return false
+}
+
+// isNetworkError reports whether err is a connection problem or server-side
+// failure that may go away on retry
+func isNetworkError(err error) bool {
+    if errors.Is(err, civogo.TimeoutError) || errors.Is(err, civogo.InternalServerError) {
+        return true
+    }
+    var netErr net.Error
+    return errors.As(err, &netErr)
+}
+
+// isRateLimited reports whether err is the API rejecting a request with 429
+// Too Many Requests. civogo does not keep the status code of responses it
+// cannot decode, so this also recognises the status in the error message.
+func isRateLimited(err error) bool {
+    if err == nil {
+        return false
+    }
+    var httpErr civogo.HTTPError
+    if errors.As(err, &httpErr) {
+        return httpErr.Code == http.StatusTooManyRequests
+    }
+    msg := strings.ToLower(err.Error())
+    return strings.Contains(msg, "code: 429") ||
+        strings.Contains(msg, "too many requests") ||
+        strings.Contains(msg, "rate limit")
+}
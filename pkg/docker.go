@@ -0,0 +1,44 @@
+package pkg
+
+import (
+    "context"
+    "fmt"
+)
+
+// DockerInstaller installs Docker Engine using Docker's convenience script
+type DockerInstaller struct{}
+
+// Name returns "docker"
+func (d DockerInstaller) Name() string { return "docker" }
+
+// DependsOn returns no dependencies
+func (d DockerInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the docker CLI is on the PATH
+func (d DockerInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, "command -v docker")
+}
+
+// Install installs Docker, enables the service and lets the SSH user run it
+func (d DockerInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    script := fmt.Sprintf(`curl -fsSL https://get.docker.com -o /tmp/get-docker.sh &&
+sudo sh /tmp/get-docker.sh &&
+sudo usermod -aG docker %s &&
+sudo systemctl enable --now docker`, instance.sshUser())
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that the Docker daemon is running and answering
+func (d DockerInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "systemctl is-active --quiet docker && sudo docker info > /dev/null")
+    return err
+}
+
+// Uninstall removes the Docker packages from the instance
+func (d DockerInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo systemctl stop docker;
+sudo apt-get remove --purge -y docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
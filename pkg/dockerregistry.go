@@ -0,0 +1,127 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+const (
+    // DefaultRegistryPort is the port the registry listens on when none is set
+    DefaultRegistryPort = 5000
+    // registryContainer is the name of the registry container on the instance
+    registryContainer = "devopsmate-registry"
+    // registryConfigDir holds the registry's htpasswd file on the instance
+    registryConfigDir = "/etc/devopsmate-registry"
+)
+
+// DockerRegistryInstaller runs a private registry:2 container on the instance
+type DockerRegistryInstaller struct {
+    // Port the registry listens on. Defaults to DefaultRegistryPort.
+    Port int
+    // Username and Password, if set, enable htpasswd basic auth
+    Username string
+    Password string
+    // TLSCertPath and TLSKeyPath, if set, are paths on the instance of the
+    // certificate and key the registry serves HTTPS with
+    TLSCertPath string
+    TLSKeyPath  string
+}
+
+// Name returns "docker-registry"
+func (r DockerRegistryInstaller) Name() string { return "docker-registry" }
+
+// DependsOn returns docker, which runs the registry container
+func (r DockerRegistryInstaller) DependsOn() []string { return []string{"docker"} }
+
+// IsInstalled reports whether the registry container exists
+func (r DockerRegistryInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, "sudo docker container inspect "+registryContainer+" > /dev/null")
+}
+
+// Install starts the registry container, restarting with the daemon, and
+// sets up basic auth and TLS if configured
+func (r DockerRegistryInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    if err := r.validate(); err != nil {
+        return err
+    }
+
+    args := []string{
+        "-d", "--name", registryContainer, "--restart=always",
+        "-p", fmt.Sprintf("%d:5000", r.port()),
+        "-v", "devopsmate-registry-data:/var/lib/registry",
+    }
+
+    script := "read -r REGISTRY_PASSWORD"
+    if r.Username != "" {
+        script += fmt.Sprintf(` &&
+sudo mkdir -p %[1]s &&
+printf '%%s\n' "$REGISTRY_PASSWORD" | sudo docker run --rm -i --entrypoint htpasswd httpd:2 -Bin %[2]s | sudo tee %[1]s/htpasswd > /dev/null`,
+            registryConfigDir, shellQuote(r.Username))
+        args = append(args,
+            "-v", registryConfigDir+":/auth:ro",
+            "-e", "REGISTRY_AUTH=htpasswd",
+            "-e", "REGISTRY_AUTH_HTPASSWD_REALM=Registry",
+            "-e", "REGISTRY_AUTH_HTPASSWD_PATH=/auth/htpasswd",
+        )
+    }
+    if r.TLSCertPath != "" {
+        args = append(args,
+            "-v", r.TLSCertPath+":/certs/domain.crt:ro",
+            "-v", r.TLSKeyPath+":/certs/domain.key:ro",
+            "-e", "REGISTRY_HTTP_TLS_CERTIFICATE=/certs/domain.crt",
+            "-e", "REGISTRY_HTTP_TLS_KEY=/certs/domain.key",
+        )
+    }
+
+    quoted := make([]string, len(args))
+    for i, arg := range args {
+        quoted[i] = shellQuote(arg)
+    }
+    // Replace any container left by an earlier or forced install
+    script += " &&\n{ sudo docker rm -f " + registryContainer + " > /dev/null 2>&1 || true; } &&\nsudo docker run " + strings.Join(quoted, " ") + " registry:2"
+    _, err := runRemoteCommandWithInput(ctx, instance, script, r.Password+"\n")
+    return err
+}
+
+// validate checks that credentials and TLS paths are each given in pairs
+func (r DockerRegistryInstaller) validate() error {
+    if r.Port < 0 || r.Port > 65535 {
+        return fmt.Errorf("docker-registry: invalid port %d", r.Port)
+    }
+    if (r.Username == "") != (r.Password == "") {
+        return errors.New("docker-registry: Username and Password must be set together")
+    }
+    if (r.TLSCertPath == "") != (r.TLSKeyPath == "") {
+        return errors.New("docker-registry: TLSCertPath and TLSKeyPath must be set together")
+    }
+    return nil
+}
+
+// Verify checks that the registry answers on /v2/. With auth enabled an
+// unauthenticated request is expected to get 401.
+func (r DockerRegistryInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    scheme := "http"
+    if r.TLSCertPath != "" {
+        scheme = "https"
+    }
+    script := fmt.Sprintf("curl -ks -o /dev/null -w '%%{http_code}' %s://localhost:%d/v2/ | grep -qE '^(200|401)$'", scheme, r.port())
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Uninstall removes the registry container and its auth config. Stored
+// images are kept in the devopsmate-registry-data volume.
+func (r DockerRegistryInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "sudo docker rm -f "+registryContainer+"; sudo rm -rf "+registryConfigDir)
+    return err
+}
+
+// port returns the configured port or DefaultRegistryPort
+func (r DockerRegistryInstaller) port() int {
+    if r.Port == 0 {
+        return DefaultRegistryPort
+    }
+    return r.Port
+}
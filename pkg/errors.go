@@ -0,0 +1,29 @@
+package pkg
+
+import "errors"
+
+// Errors returned, wrapped, by provisioning so callers can tell common
+// failures apart with errors.Is
+var (
+    // ErrAuth means the Civo API rejected the API key
+    ErrAuth = errors.New("Civo rejected the API key")
+    // ErrInstanceTimeout means an instance did not reach the expected state
+    // in time, such as becoming active after creation or going away after
+    // deletion
+    ErrInstanceTimeout = errors.New("timed out waiting for instance")
+    // ErrSSHUnreachable means the instance could not be reached over SSH
+    ErrSSHUnreachable = errors.New("SSH unreachable")
+)
+
+// InstallerError is returned, wrapped, when an installer fails to install,
+// verify or report its outputs. Callers can find the installer with errors.As.
+type InstallerError struct {
+    // Name is the name of the installer that failed
+    Name string
+    // Err describes the failure
+    Err error
+}
+
+func (e *InstallerError) Error() string { return e.Err.Error() }
+
+func (e *InstallerError) Unwrap() error { return e.Err }
@@ -0,0 +1,171 @@
+package pkg
+
+import (
+    "errors"
+    "fmt"
+    "log/slog"
+    "net"
+    "slices"
+    "strconv"
+    "strings"
+
+    "github.com/civo/civogo"
+)
+
+// FirewallRule allows inbound traffic on a port range from a set of networks
+type FirewallRule struct {
+    // Protocol is tcp, udp or icmp. Defaults to tcp.
+    Protocol string
+    // StartPort is the first port allowed. Ignored for icmp.
+    StartPort int
+    // EndPort is the last port allowed. Defaults to StartPort.
+    EndPort int
+    // CIDRs are the source networks allowed. Defaults to anywhere.
+    CIDRs []string
+}
+
+// anywhere is the source network used by rules that give no CIDRs
+const anywhere = "0.0.0.0/0"
+
+// withDefaults returns a copy of the rule with unset fields filled in
+func (r FirewallRule) withDefaults() FirewallRule {
+    if r.Protocol == "" {
+        r.Protocol = "tcp"
+    }
+    r.Protocol = strings.ToLower(r.Protocol)
+    if r.EndPort == 0 {
+        r.EndPort = r.StartPort
+    }
+    if len(r.CIDRs) == 0 {
+        r.CIDRs = []string{anywhere}
+    }
+    return r
+}
+
+// validate checks the protocol, port range and CIDRs of a defaulted rule
+func (r FirewallRule) validate() error {
+    switch r.Protocol {
+    case "tcp", "udp":
+        if r.StartPort < 1 || r.StartPort > 65535 || r.EndPort < 1 || r.EndPort > 65535 {
+            return fmt.Errorf("ports must be between 1 and 65535, got %d-%d", r.StartPort, r.EndPort)
+        }
+        if r.EndPort < r.StartPort {
+            return fmt.Errorf("end port %d is before start port %d", r.EndPort, r.StartPort)
+        }
+    case "icmp":
+    default:
+        return fmt.Errorf("unknown protocol %q, must be tcp, udp or icmp", r.Protocol)
+    }
+
+    for _, cidr := range r.CIDRs {
+        if _, _, err := net.ParseCIDR(cidr); err != nil {
+            return fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+        }
+    }
+    return nil
+}
+
+// allowsTCP reports whether the rule lets in TCP connections to port
+func (r FirewallRule) allowsTCP(port int) bool {
+    return r.Protocol == "tcp" && r.StartPort <= port && r.EndPort >= port
+}
+
+// validateFirewallRules defaults and validates rules. The rules must allow
+// sshPort, since installers cannot reach the instance otherwise.
+func validateFirewallRules(rules []FirewallRule, sshPort int) ([]FirewallRule, error) {
+    defaulted := make([]FirewallRule, len(rules))
+    var errs []error
+    ssh := false
+    for i, rule := range rules {
+        rule = rule.withDefaults()
+        if err := rule.validate(); err != nil {
+            errs = append(errs, fmt.Errorf("firewall rule %d: %w", i+1, err))
+        }
+        ssh = ssh || rule.allowsTCP(sshPort)
+        defaulted[i] = rule
+    }
+    if !ssh {
+        errs = append(errs, fmt.Errorf("firewall rules must allow tcp port %d so installers can connect", sshPort))
+    }
+    return defaulted, errors.Join(errs...)
+}
+
+// jenkinsPort is the port the Jenkins web UI listens on
+const jenkinsPort = 8080
+
+// withJenkinsRule returns defaulted rules plus one letting in the Jenkins web
+// UI from the networks allowed to reach sshPort, unless a rule already allows it
+func withJenkinsRule(rules []FirewallRule, sshPort int) []FirewallRule {
+    var cidrs []string
+    for _, rule := range rules {
+        if rule.allowsTCP(jenkinsPort) {
+            return rules
+        }
+        if rule.allowsTCP(sshPort) {
+            cidrs = append(cidrs, rule.CIDRs...)
+        }
+    }
+    slices.Sort(cidrs)
+    jenkins := FirewallRule{Protocol: "tcp", StartPort: jenkinsPort, EndPort: jenkinsPort, CIDRs: slices.Compact(cidrs)}
+    return append(slices.Clone(rules), jenkins)
+}
+
+// createFirewall creates a firewall on the network that only lets in the given
+// traffic, and allows all outbound traffic so installers can download packages
+func createFirewall(client civoClient, regionCode, name, networkID string, rules []FirewallRule) (string, error) {
+    createRules := false
+    var civoRules []civogo.FirewallRule
+    for _, rule := range rules {
+        civoRule := civogo.FirewallRule{
+            Protocol:  rule.Protocol,
+            Cidr:      rule.CIDRs,
+            Direction: "ingress",
+            Action:    "allow",
+        }
+        if rule.Protocol != "icmp" {
+            civoRule.StartPort = strconv.Itoa(rule.StartPort)
+            civoRule.EndPort = strconv.Itoa(rule.EndPort)
+        }
+        civoRules = append(civoRules, civoRule)
+    }
+    for _, protocol := range []string{"tcp", "udp"} {
+        civoRules = append(civoRules, civogo.FirewallRule{
+            Protocol:  protocol,
+            StartPort: "1",
+            EndPort:   "65535",
+            Cidr:      []string{anywhere},
+            Direction: "egress",
+            Action:    "allow",
+        })
+    }
+    civoRules = append(civoRules, civogo.FirewallRule{
+        Protocol:  "icmp",
+        Cidr:      []string{anywhere},
+        Direction: "egress",
+        Action:    "allow",
+    })
+
+    slog.Info("creating firewall", "name", name, "rules", len(rules))
+    firewall, err := client.NewFirewall(&civogo.FirewallConfig{
+        Name:        name,
+        Region:      regionCode,
+        NetworkID:   networkID,
+        CreateRules: &createRules,
+        Rules:       civoRules,
+    })
+    if err != nil {
+        return "", fmt.Errorf("error creating firewall %s: %w", name, err)
+    }
+    return firewall.ID, nil
+}
+
+// deleteFirewall deletes a firewall created by createFirewall. A firewall
+// that is already gone counts as deleted.
+func deleteFirewall(client civoClient, id string) error {
+    _, err := client.DeleteFirewall(id)
+    if err != nil && !errors.Is(err, civogo.DatabaseFirewallNotFoundError) {
+        return fmt.Errorf("error deleting firewall %s: %w", id, err)
+    }
+    slog.Info("firewall deleted", "id", id)
+    return nil
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+    "context"
+    "fmt"
+    "net/url"
+    "strings"
+)
+
+// gitlabConfigPath is the omnibus configuration file on the instance
+const gitlabConfigPath = "/etc/gitlab/gitlab.rb"
+
+// GitLabInstaller installs GitLab CE from GitLab's omnibus package repository
+type GitLabInstaller struct {
+    // ExternalURL is the URL users reach GitLab at, e.g. "https://gitlab.example.com".
+    // Defaults to http://<instance public IP>.
+    ExternalURL string
+}
+
+// Name returns "gitlab"
+func (g GitLabInstaller) Name() string { return "gitlab" }
+
+// DependsOn returns no dependencies
+func (g GitLabInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the gitlab-ce package is installed
+func (g GitLabInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, dpkgInstalledScript("gitlab-ce"))
+}
+
+// Install installs GitLab, sets external_url and reconfigures it
+func (g GitLabInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    externalURL, err := g.externalURL(instance)
+    if err != nil {
+        return err
+    }
+
+    script := fmt.Sprintf(`sudo apt-get update &&
+sudo apt-get install -y curl openssh-server ca-certificates tzdata perl &&
+curl -fsSL https://packages.gitlab.com/install/repositories/gitlab/gitlab-ce/script.deb.sh | sudo bash &&
+sudo EXTERNAL_URL=%[1]s apt-get install -y gitlab-ce &&
+sudo sed -i "s|^external_url .*|external_url '%[2]s'|" %[3]s &&
+sudo gitlab-ctl reconfigure`, shellQuote(externalURL), externalURL, gitlabConfigPath)
+    _, err = runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks GitLab's health endpoint
+func (g GitLabInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    externalURL, err := g.externalURL(instance)
+    if err != nil {
+        return err
+    }
+    scheme := "http"
+    if strings.HasPrefix(externalURL, "https://") {
+        scheme = "https"
+    }
+    _, err = runRemoteCommand(ctx, instance, fmt.Sprintf("curl -fsSk -o /dev/null %s://localhost/-/health", scheme))
+    return err
+}
+
+// Outputs returns the password GitLab generated for the root user under the
+// "initial-root-password" key. GitLab deletes the file 24 hours after install.
+func (g GitLabInstaller) Outputs(ctx context.Context, instance InstanceDetails) (map[string]string, error) {
+    out, err := readRemoteCommand(ctx, instance, "sudo sed -n 's/^Password: //p' /etc/gitlab/initial_root_password")
+    if err != nil {
+        return nil, err
+    }
+    return map[string]string{"initial-root-password": strings.TrimSpace(out)}, nil
+}
+
+// Uninstall removes GitLab from the instance
+func (g GitLabInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo gitlab-ctl stop;
+sudo apt-get remove --purge -y gitlab-ce &&
+sudo rm -f /etc/apt/sources.list.d/gitlab_gitlab-ce.list`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// externalURL returns the configured URL, or one built from the public IP,
+// after checking it is an absolute http or https URL. A dry run has no
+// public IP yet and gets a placeholder instead.
+func (g GitLabInstaller) externalURL(instance InstanceDetails) (string, error) {
+    raw := g.ExternalURL
+    if raw == "" {
+        if instance.DryRun && instance.PublicIP == "" {
+            return "http://<public-ip>", nil
+        }
+        raw = "http://" + instance.PublicIP
+    }
+    u, err := url.Parse(raw)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return "", fmt.Errorf("gitlab: invalid external URL %q: must be an http or https URL", raw)
+    }
+    if strings.ContainsAny(raw, `'"|\`) {
+        return "", fmt.Errorf("gitlab: invalid external URL %q", raw)
+    }
+    return raw, nil
+}
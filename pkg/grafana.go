@@ -0,0 +1,56 @@
+package pkg
+
+import (
+    "context"
+)
+
+// GrafanaInstaller installs Grafana from Grafana's apt repository
+type GrafanaInstaller struct {
+    // AdminPassword, if set, replaces the default "admin" password
+    AdminPassword string
+}
+
+// Name returns "grafana"
+func (g GrafanaInstaller) Name() string { return "grafana" }
+
+// DependsOn returns no dependencies
+func (g GrafanaInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the grafana package is installed
+func (g GrafanaInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, dpkgInstalledScript("grafana"))
+}
+
+// Install installs Grafana and sets the admin password if one is set
+func (g GrafanaInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    script := `read -r GRAFANA_PASSWORD &&
+sudo apt-get update &&
+sudo apt-get install -y apt-transport-https software-properties-common wget gpg &&
+sudo mkdir -p /etc/apt/keyrings &&
+wget -q -O - https://apt.grafana.com/gpg.key | gpg --dearmor | sudo tee /etc/apt/keyrings/grafana.gpg > /dev/null &&
+echo "deb [signed-by=/etc/apt/keyrings/grafana.gpg] https://apt.grafana.com stable main" | sudo tee /etc/apt/sources.list.d/grafana.list > /dev/null &&
+sudo apt-get update &&
+sudo apt-get install -y grafana &&
+sudo systemctl enable --now grafana-server`
+    if g.AdminPassword != "" {
+        script += ` &&
+printf '%s\n' "$GRAFANA_PASSWORD" | sudo grafana-cli admin reset-admin-password --password-from-stdin`
+    }
+    _, err := runRemoteCommandWithInput(ctx, instance, script, g.AdminPassword+"\n")
+    return err
+}
+
+// Verify checks that Grafana is listening and healthy on port 3000
+func (g GrafanaInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "curl -fsS -o /dev/null http://localhost:3000/api/health")
+    return err
+}
+
+// Uninstall removes Grafana and its apt repository from the instance
+func (g GrafanaInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo systemctl stop grafana-server;
+sudo apt-get remove --purge -y grafana &&
+sudo rm -f /etc/apt/sources.list.d/grafana.list /etc/apt/keyrings/grafana.gpg`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
@@ -0,0 +1,41 @@
+package pkg
+
+import (
+    "context"
+)
+
+// HelmInstaller installs the Helm 3 CLI, which uses the kubeconfig the
+// kubernetes installer saved on the instance
+type HelmInstaller struct{}
+
+// Name returns "helm"
+func (h HelmInstaller) Name() string { return "helm" }
+
+// DependsOn returns "kubernetes", since Helm is of no use without the cluster
+func (h HelmInstaller) DependsOn() []string { return []string{"kubernetes"} }
+
+// IsInstalled reports whether the helm CLI is on the PATH
+func (h HelmInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, "command -v helm")
+}
+
+// Install installs Helm using its official install script
+func (h HelmInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    script := `curl -fsSL -o /tmp/get-helm-3.sh https://raw.githubusercontent.com/helm/helm/main/scripts/get-helm-3 &&
+bash /tmp/get-helm-3.sh &&
+rm -f /tmp/get-helm-3.sh`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that helm runs and can reach the cluster
+func (h HelmInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "helm version && helm list --all-namespaces > /dev/null")
+    return err
+}
+
+// Uninstall removes the helm CLI from the instance
+func (h HelmInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "sudo rm -f /usr/local/bin/helm")
+    return err
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "reflect"
+    "sort"
+)
+
+// LoadInstallerConfig reads the options of built-in installers from a JSON
+// object in path, keyed by installer name, e.g.
+//
+//	{"jenkins": {"version": "2.440.3", "plugins": ["git"]},
+//	 "kubernetes": {"clusterName": "ci", "nodeCount": 2, "timeout": "20m"}}
+//
+// Keys within each entry are the installer's field names, matched case
+// insensitively. The installers returned are meant for
+// InstanceOptions.Configured and replace the registered ones of the same
+// name, so dependencies between installers are unaffected.
+func LoadInstallerConfig(path string) ([]SoftwareInstaller, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("error reading installer config: %w", err)
+    }
+    var entries map[string]json.RawMessage
+    if err := json.Unmarshal(data, &entries); err != nil {
+        return nil, fmt.Errorf("error parsing installer config %s: %w", path, err)
+    }
+
+    names := make([]string, 0, len(entries))
+    for name := range entries {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var errs []error
+    installers := make([]SoftwareInstaller, 0, len(names))
+    for _, name := range names {
+        registered, ok := LookupInstaller(name)
+        if !ok {
+            errs = append(errs, fmt.Errorf("unknown installer %s", name))
+            continue
+        }
+        if _, ok := registered.(ScriptInstaller); ok {
+            errs = append(errs, fmt.Errorf("installer %s is defined by --installer-file and has no options", name))
+            continue
+        }
+        installer, err := decodeInstaller(registered, entries[name])
+        if err != nil {
+            errs = append(errs, fmt.Errorf("installer %s: %w", name, err))
+            continue
+        }
+        installers = append(installers, installer)
+    }
+    if err := errors.Join(errs...); err != nil {
+        return nil, fmt.Errorf("invalid installer config %s: %w", path, err)
+    }
+    return installers, nil
+}
+
+// decodeInstaller decodes data into a new value of the same type as registered,
+// starting from registered's own field values
+func decodeInstaller(registered SoftwareInstaller, data json.RawMessage) (SoftwareInstaller, error) {
+    v := reflect.New(reflect.TypeOf(registered))
+    v.Elem().Set(reflect.ValueOf(registered))
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(v.Interface()); err != nil {
+        return nil, err
+    }
+    installer, ok := v.Elem().Interface().(SoftwareInstaller)
+    if !ok {
+        return nil, errors.New("installer cannot be configured")
+    }
+    return installer, nil
+}
@@ -0,0 +1,601 @@
+package pkg
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/civo/civogo"
+)
+
+// SoftwareInstaller installs, verifies and removes a piece of software on a
+// provisioned instance
+type SoftwareInstaller interface {
+    // Name identifies the installer, e.g. "jenkins"
+    Name() string
+    // DependsOn lists the names of installers that must run before this one
+    DependsOn() []string
+    // IsInstalled reports whether the software is already present on the instance
+    IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error)
+    Install(ctx context.Context, instance InstanceDetails) error
+    // Verify checks that the installed software is actually working
+    Verify(ctx context.Context, instance InstanceDetails) error
+    Uninstall(ctx context.Context, instance InstanceDetails) error
+}
+
+// OutputProvider is implemented by installers that produce values the user
+// needs after installation, such as generated credentials
+type OutputProvider interface {
+    Outputs(ctx context.Context, instance InstanceDetails) (map[string]string, error)
+}
+
+// civoInstaller is implemented by installers that talk to the Civo API and
+// need the credentials CreateComputeInstance was called with
+type civoInstaller interface {
+    withCivoCredentials(apiKey, region string) SoftwareInstaller
+}
+
+// UsesCivoAPI reports whether installer talks to the Civo API and so needs
+// credentials from WithCivoCredentials
+func UsesCivoAPI(installer SoftwareInstaller) bool {
+    _, ok := installer.(civoInstaller)
+    return ok
+}
+
+// WithCivoCredentials returns installer with the Civo API key and region filled
+// in if it uses the Civo API, and installer unchanged otherwise
+func WithCivoCredentials(installer SoftwareInstaller, apiKey, region string) SoftwareInstaller {
+    if c, ok := installer.(civoInstaller); ok {
+        return c.withCivoCredentials(apiKey, region)
+    }
+    return installer
+}
+
+// JenkinsInstaller installs Jenkins along with the JDK it needs
+type JenkinsInstaller struct {
+    // Version pins the Jenkins package version, e.g. "2.440.3". Empty installs the latest.
+    Version string
+    // Plugins are installed along with their dependencies before Jenkins is
+    // restarted, e.g. "git" or "workflow-aggregator:596.v8c21c963d92d" to pin a version
+    Plugins []string
+}
+
+const (
+    // jenkinsPluginManagerVersion is the release of Jenkins' plugin installation
+    // manager used to install JenkinsInstaller.Plugins
+    jenkinsPluginManagerVersion = "2.13.2"
+    jenkinsPluginDir            = "/var/lib/jenkins/plugins"
+)
+
+// jenkinsPluginPattern matches a plugin ID, optionally followed by a version
+var jenkinsPluginPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+(:[A-Za-z0-9_.-]+)?$`)
+
+// SonarQubeInstaller installs SonarQube. By default SonarQube uses its embedded
+// database; setting the JDBC fields points it at an external one instead.
+type SonarQubeInstaller struct {
+    JDBCURL      string
+    JDBCUsername string
+    JDBCPassword string
+    // LocalPostgreSQL makes SonarQube depend on the postgresql installer, for
+    // a JDBCURL pointing at a database created on the same instance
+    LocalPostgreSQL bool
+}
+
+const (
+    // sonarPropertiesPath is where the SonarQube package keeps its configuration
+    sonarPropertiesPath = "/opt/sonarqube/conf/sonar.properties"
+    // sonarMaxMapCount is the vm.max_map_count SonarQube's embedded
+    // Elasticsearch needs, without which it refuses to start
+    sonarMaxMapCount = 262144
+    // sonarStartTimeout is how long SonarQube may take to come up after
+    // starting, longer than DefaultVerifyTimeout
+    sonarStartTimeout = 5 * time.Minute
+)
+
+// BuildPackInstaller installs the Cloud Native Buildpacks pack CLI and, when
+// Source is set, builds an image from it with pack build
+type BuildPackInstaller struct {
+    // Source is the application to build: a directory on the instance or a
+    // git URL, which is cloned first. Empty only installs the pack CLI.
+    Source string
+    // Builder is the builder image used by pack build. Defaults to DefaultBuilder.
+    Builder string
+    // Image names the built image. Defaults to DefaultBuildImage.
+    Image string
+}
+
+// Defaults for the image built by BuildPackInstaller
+const (
+    DefaultBuilder    = "paketobuildpacks/builder-jammy-base"
+    DefaultBuildImage = "app:latest"
+)
+
+// imageReferencePattern matches a container image reference such as
+// "registry.example.com/team/app:1.0"
+var imageReferencePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._/-]*(:[A-Za-z0-9_.-]+)?(@sha256:[a-f0-9]{64})?$`)
+
+// CivoKubernetesInstaller creates a Kubernetes cluster through the Civo API and
+// saves its kubeconfig on the instance
+type CivoKubernetesInstaller struct {
+    APIKey string
+    Region string
+    // ClusterName defaults to "devopsmate-<hostname>" for the instance being
+    // set up, or DefaultClusterName if its hostname is not known
+    ClusterName string
+    // NodeSize is the Civo size of each node. Defaults to DefaultNodeSize.
+    NodeSize string
+    // NodeCount is the number of nodes in the cluster. Defaults to DefaultNodeCount.
+    NodeCount int
+    // Timeout bounds how long to wait for the cluster to become ready, separately
+    // from InstanceOptions.InstallerTimeout. Defaults to DefaultTimeout.
+    Timeout time.Duration
+}
+
+// UnmarshalJSON decodes the installer like any other struct, except that
+// Timeout is given as a duration string such as "20m"
+func (k *CivoKubernetesInstaller) UnmarshalJSON(data []byte) error {
+    type plain CivoKubernetesInstaller
+    aux := struct {
+        *plain
+        Timeout string
+    }{plain: (*plain)(k)}
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&aux); err != nil {
+        return err
+    }
+    if aux.Timeout != "" {
+        timeout, err := time.ParseDuration(aux.Timeout)
+        if err != nil {
+            return fmt.Errorf("invalid timeout: %w", err)
+        }
+        k.Timeout = timeout
+    }
+    return nil
+}
+
+// Defaults for the cluster created by CivoKubernetesInstaller
+const (
+    DefaultClusterName = "my-cluster"
+    DefaultNodeSize    = "g3.k3s.medium"
+    DefaultNodeCount   = 3
+)
+
+// Name returns "jenkins"
+func (j JenkinsInstaller) Name() string { return "jenkins" }
+
+// DependsOn returns no dependencies
+func (j JenkinsInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the jenkins package and every plugin are installed
+func (j JenkinsInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    script := dpkgInstalledScript("jenkins")
+    if len(j.Plugins) > 0 {
+        script += " && " + j.pluginsInstalledScript()
+    }
+    return probeRemoteCommand(ctx, instance, script)
+}
+
+// Install installs Jenkins on the instance, then any plugins
+func (j JenkinsInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    for _, plugin := range j.Plugins {
+        if !jenkinsPluginPattern.MatchString(plugin) {
+            return fmt.Errorf("jenkins: invalid plugin %q, expected an ID such as git or git:5.2.2", plugin)
+        }
+    }
+
+    script := `sudo apt-get update &&
+sudo apt-get install -y fontconfig openjdk-17-jre &&
+sudo wget -O /usr/share/keyrings/jenkins-keyring.asc https://pkg.jenkins.io/debian-stable/jenkins.io-2023.key &&
+echo "deb [signed-by=/usr/share/keyrings/jenkins-keyring.asc] https://pkg.jenkins.io/debian-stable binary/" | sudo tee /etc/apt/sources.list.d/jenkins.list > /dev/null &&
+sudo apt-get update &&
+`
+    if j.Version != "" {
+        version := shellQuote(j.Version)
+        script += fmt.Sprintf(`{ apt-cache madison jenkins | awk '{print $3}' | grep -qxF %s || { echo jenkins version %s is not available >&2; exit 1; }; } &&
+sudo apt-get install -y jenkins=%s`, version, version, version)
+    } else {
+        script += "sudo apt-get install -y jenkins"
+    }
+    if len(j.Plugins) > 0 {
+        quoted := make([]string, len(j.Plugins))
+        for i, plugin := range j.Plugins {
+            quoted[i] = shellQuote(plugin)
+        }
+        script += fmt.Sprintf(` &&
+sudo wget -qO /usr/local/lib/jenkins-plugin-manager.jar https://github.com/jenkinsci/plugin-installation-manager-tool/releases/download/%[1]s/jenkins-plugin-manager-%[1]s.jar &&
+sudo java -jar /usr/local/lib/jenkins-plugin-manager.jar --war /usr/share/java/jenkins.war --plugin-download-directory %[2]s --plugins %[3]s &&
+sudo chown -R jenkins:jenkins %[2]s &&
+sudo systemctl restart jenkins`, jenkinsPluginManagerVersion, jenkinsPluginDir, strings.Join(quoted, " "))
+    }
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that the Jenkins service is running and serving on port 8080,
+// and that every plugin is installed
+func (j JenkinsInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    script := "systemctl is-active --quiet jenkins && curl -fsS -o /dev/null http://localhost:8080/login"
+    if len(j.Plugins) > 0 {
+        script += " && " + j.pluginsInstalledScript()
+    }
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// pluginsInstalledScript returns a shell check that fails naming the first
+// plugin missing from the Jenkins plugin directory
+func (j JenkinsInstaller) pluginsInstalledScript() string {
+    checks := make([]string, len(j.Plugins))
+    for i, plugin := range j.Plugins {
+        id := shellQuote(strings.SplitN(plugin, ":", 2)[0])
+        checks[i] = fmt.Sprintf("{ test -e %[1]s/%[2]s.jpi || test -e %[1]s/%[2]s.hpi || { echo jenkins plugin %[2]s is not installed >&2; false; }; }", jenkinsPluginDir, id)
+    }
+    return strings.Join(checks, " && ")
+}
+
+// Outputs returns the initial admin password Jenkins generated on first start
+// under the "initial-admin-password" key
+func (j JenkinsInstaller) Outputs(ctx context.Context, instance InstanceDetails) (map[string]string, error) {
+    out, err := readRemoteCommand(ctx, instance, "sudo cat /var/lib/jenkins/secrets/initialAdminPassword")
+    if err != nil {
+        return nil, err
+    }
+    return map[string]string{"initial-admin-password": strings.TrimSpace(out)}, nil
+}
+
+// Uninstall removes Jenkins and its apt repository from the instance
+func (j JenkinsInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo systemctl stop jenkins;
+sudo apt-get remove --purge -y jenkins &&
+sudo rm -f /etc/apt/sources.list.d/jenkins.list /usr/share/keyrings/jenkins-keyring.asc /usr/local/lib/jenkins-plugin-manager.jar`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Name returns "sonarqube"
+func (s SonarQubeInstaller) Name() string { return "sonarqube" }
+
+// DependsOn returns jenkins, whose installer provides the JDK SonarQube runs
+// on, and postgresql if LocalPostgreSQL is set
+func (s SonarQubeInstaller) DependsOn() []string {
+    if s.LocalPostgreSQL {
+        return []string{"jenkins", "postgresql"}
+    }
+    return []string{"jenkins"}
+}
+
+// IsInstalled reports whether the sonarqube package is installed and
+// vm.max_map_count is persisted, so instances set up before the tuning get it
+func (s SonarQubeInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    script := dpkgInstalledScript("sonarqube") + fmt.Sprintf(" && grep -qx 'vm.max_map_count=%d' /etc/sysctl.conf", sonarMaxMapCount)
+    return probeRemoteCommand(ctx, instance, script)
+}
+
+// Install installs SonarQube on the instance
+func (s SonarQubeInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    if err := s.validate(); err != nil {
+        return err
+    }
+
+    script := fmt.Sprintf(`read -r JDBC_PASSWORD &&
+sudo sysctl -w vm.max_map_count=%[1]d &&
+{ sudo sed -i '/^[[:space:]]*vm\.max_map_count[[:space:]]*=/d' /etc/sysctl.conf; echo 'vm.max_map_count=%[1]d' | sudo tee -a /etc/sysctl.conf > /dev/null; } &&
+sudo apt-get update &&
+sudo apt-get install -y sonarqube`, sonarMaxMapCount)
+    if s.JDBCURL != "" {
+        script += fmt.Sprintf(` &&
+sudo sed -i '/^sonar\.jdbc\./d' %s &&
+printf 'sonar.jdbc.url=%%s\nsonar.jdbc.username=%%s\nsonar.jdbc.password=%%s\n' %s %s "$JDBC_PASSWORD" | sudo tee -a %s > /dev/null`,
+            sonarPropertiesPath, shellQuote(s.JDBCURL), shellQuote(s.JDBCUsername), sonarPropertiesPath)
+    }
+    script += " &&\nsudo systemctl enable sonarqube && sudo systemctl restart sonarqube"
+    _, err := runRemoteCommandWithInput(ctx, instance, script, s.JDBCPassword+"\n")
+    return err
+}
+
+// validate checks that the external database settings are either all set or all empty
+func (s SonarQubeInstaller) validate() error {
+    set := 0
+    for _, v := range []string{s.JDBCURL, s.JDBCUsername, s.JDBCPassword} {
+        if v != "" {
+            set++
+        }
+    }
+    if set != 0 && set != 3 {
+        return errors.New("sonarqube: JDBCURL, JDBCUsername and JDBCPassword must be set together")
+    }
+    return nil
+}
+
+// Verify checks that vm.max_map_count is high enough and that SonarQube is
+// running and reports itself up, printing the end of its log if the service
+// has stopped
+func (s SonarQubeInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    script := fmt.Sprintf(`[ "$(sysctl -n vm.max_map_count)" -ge %d ] || { echo vm.max_map_count is too low for SonarQube >&2; exit 1; }
+systemctl is-active --quiet sonarqube || { echo SonarQube is not running >&2; sudo journalctl -u sonarqube -n 20 --no-pager >&2; exit 1; }
+curl -fsS http://localhost:9000/api/system/status | grep -q '"status":"UP"' || { echo SonarQube is not up yet >&2; exit 1; }`, sonarMaxMapCount)
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// startTimeout returns how long Verify is retried for while SonarQube starts
+func (s SonarQubeInstaller) startTimeout() time.Duration { return sonarStartTimeout }
+
+// Uninstall removes SonarQube from the instance
+func (s SonarQubeInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo systemctl stop sonarqube;
+sudo apt-get remove --purge -y sonarqube`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Name returns "buildpack"
+func (b BuildPackInstaller) Name() string { return "buildpack" }
+
+// DependsOn returns docker when Source is set, since pack build runs the
+// builder in containers
+func (b BuildPackInstaller) DependsOn() []string {
+    if b.Source != "" {
+        return []string{"docker"}
+    }
+    return nil
+}
+
+// builder returns Builder, or DefaultBuilder if it is unset
+func (b BuildPackInstaller) builder() string {
+    if b.Builder == "" {
+        return DefaultBuilder
+    }
+    return b.Builder
+}
+
+// image returns Image, or DefaultBuildImage if it is unset
+func (b BuildPackInstaller) image() string {
+    if b.Image == "" {
+        return DefaultBuildImage
+    }
+    return b.Image
+}
+
+// validate checks the builder and image references
+func (b BuildPackInstaller) validate() error {
+    if !imageReferencePattern.MatchString(b.builder()) {
+        return fmt.Errorf("buildpack: invalid builder image %q", b.builder())
+    }
+    if !imageReferencePattern.MatchString(b.image()) {
+        return fmt.Errorf("buildpack: invalid image name %q", b.image())
+    }
+    return nil
+}
+
+// isGitSource reports whether Source is a git URL rather than a directory
+func (b BuildPackInstaller) isGitSource() bool {
+    return strings.HasPrefix(b.Source, "https://") || strings.HasPrefix(b.Source, "git@") ||
+        strings.HasPrefix(b.Source, "ssh://") || strings.HasSuffix(b.Source, ".git")
+}
+
+// IsInstalled reports whether the pack CLI is on the PATH and, when Source is
+// set, whether the image has been built
+func (b BuildPackInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    script := "command -v pack"
+    if b.Source != "" {
+        script += " && sudo docker image inspect " + shellQuote(b.image()) + " > /dev/null"
+    }
+    return probeRemoteCommand(ctx, instance, script)
+}
+
+// Install installs the pack CLI on the instance, then builds Source if it is set
+func (b BuildPackInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    script := `curl -sSL "https://github.com/buildpacks/pack/releases/download/v0.35.1/pack-v0.35.1-linux.tgz" | sudo tar -C /usr/local/bin/ --no-same-owner -xzv pack`
+    if b.Source != "" {
+        if err := b.validate(); err != nil {
+            return err
+        }
+        build := fmt.Sprintf("sudo pack build %s --builder %s --trust-builder", shellQuote(b.image()), shellQuote(b.builder()))
+        if b.isGitSource() {
+            script += fmt.Sprintf(` &&
+{ command -v git > /dev/null || { sudo apt-get update && sudo apt-get install -y git; }; } &&
+src=$(mktemp -d) && trap 'rm -rf "$src"' EXIT &&
+git clone --depth 1 %s "$src" &&
+%s --path "$src"`, shellQuote(b.Source), build)
+        } else {
+            script += fmt.Sprintf(` &&
+%s --path %s`, build, shellQuote(b.Source))
+        }
+    }
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that the pack CLI runs and, when Source is set, that the
+// image exists
+func (b BuildPackInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    script := "pack version"
+    if b.Source != "" {
+        script += " && sudo docker image inspect " + shellQuote(b.image()) + " > /dev/null"
+    }
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Outputs returns the name and ID of the built image under the "image" and
+// "image-id" keys. Nothing is returned when Source is unset.
+func (b BuildPackInstaller) Outputs(ctx context.Context, instance InstanceDetails) (map[string]string, error) {
+    if b.Source == "" {
+        return nil, nil
+    }
+    out, err := readRemoteCommand(ctx, instance, "sudo docker image inspect --format '{{.Id}}' "+shellQuote(b.image()))
+    if err != nil {
+        return nil, err
+    }
+    return map[string]string{"image": b.image(), "image-id": strings.TrimSpace(out)}, nil
+}
+
+// Uninstall removes the pack CLI, and the built image if Source is set, from
+// the instance
+func (b BuildPackInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := "sudo rm -f /usr/local/bin/pack"
+    if b.Source != "" {
+        script += " && { sudo docker image rm -f " + shellQuote(b.image()) + " 2> /dev/null || true; }"
+    }
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// withCivoCredentials fills in the API key and region unless they are already set
+func (k CivoKubernetesInstaller) withCivoCredentials(apiKey, region string) SoftwareInstaller {
+    if k.APIKey == "" {
+        k.APIKey = apiKey
+    }
+    if k.Region == "" {
+        k.Region = region
+    }
+    return k
+}
+
+// Name returns "kubernetes"
+func (k CivoKubernetesInstaller) Name() string { return "kubernetes" }
+
+// DependsOn returns no dependencies
+func (k CivoKubernetesInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the cluster already exists. In dry run it
+// reports false without calling the API.
+func (k CivoKubernetesInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    if instance.DryRun {
+        return false, nil
+    }
+    cluster, err := k.findCluster(ctx, instance)
+    if err != nil {
+        return false, err
+    }
+    return cluster != nil, nil
+}
+
+// Install creates a Kubernetes cluster through the Civo API, waits for it to
+// become ready and saves its kubeconfig to ~/.kube/config on the instance
+func (k CivoKubernetesInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    if k.NodeCount < 0 {
+        return fmt.Errorf("kubernetes: node count must be at least 1, got %d", k.NodeCount)
+    }
+    if instance.DryRun {
+        fmt.Fprintf(instance.output(), "[dry-run] would create Kubernetes cluster %s in %s\n", k.clusterName(instance), k.Region)
+        return nil
+    }
+
+    kubeconfig, err := CreateKubernetesClusterContext(ctx, k.APIKey, k.Region, ClusterOptions{
+        Name:      k.clusterName(instance),
+        NodeSize:  k.NodeSize,
+        NodeCount: k.NodeCount,
+        Timeout:   k.Timeout,
+        Created: func(string) {
+            if instance.clusterCreated != nil {
+                instance.clusterCreated(k.clusterName(instance))
+            }
+        },
+    })
+    if err != nil {
+        return err
+    }
+
+    // The kubeconfig holds cluster credentials, so it is passed on stdin
+    // rather than written into the script.
+    _, err = runRemoteCommandWithInput(ctx, instance, "mkdir -p ~/.kube && umask 077 && cat > ~/.kube/config", kubeconfig)
+    return err
+}
+
+// Verify checks that the Kubernetes cluster reports itself as active
+func (k CivoKubernetesInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    if instance.DryRun {
+        return nil
+    }
+    cluster, err := k.findCluster(ctx, instance)
+    if err != nil {
+        return err
+    }
+    if cluster == nil {
+        return fmt.Errorf("kubernetes: cluster %s not found", k.clusterName(instance))
+    }
+    if !cluster.Ready || cluster.Status != "ACTIVE" {
+        return fmt.Errorf("kubernetes: cluster %s is %s, not ACTIVE", k.clusterName(instance), cluster.Status)
+    }
+    return nil
+}
+
+// Outputs returns the cluster's kubeconfig, which Install saved to
+// ~/.kube/config on the instance, under the "kubeconfig" key, and the
+// cluster's name under "cluster-name"
+func (k CivoKubernetesInstaller) Outputs(ctx context.Context, instance InstanceDetails) (map[string]string, error) {
+    if instance.DryRun {
+        return nil, nil
+    }
+    out, err := readRemoteCommand(ctx, instance, "cat ~/.kube/config")
+    if err != nil {
+        return nil, err
+    }
+    return map[string]string{"kubeconfig": out, "cluster-name": k.clusterName(instance)}, nil
+}
+
+// Uninstall deletes the Kubernetes cluster created by Install and the
+// kubeconfig saved on the instance
+func (k CivoKubernetesInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    cluster, err := k.findCluster(ctx, instance)
+    if err != nil {
+        return err
+    }
+    if cluster != nil {
+        client, err := newCivoClient(ctx, k.APIKey, k.Region)
+        if err != nil {
+            return err
+        }
+        if _, err := client.DeleteKubernetesCluster(cluster.ID); err != nil {
+            return fmt.Errorf("error deleting Kubernetes cluster %s: %w", k.clusterName(instance), err)
+        }
+    }
+    _, err = runRemoteCommand(ctx, instance, "rm -f ~/.kube/config")
+    return err
+}
+
+// findCluster looks up the installer's cluster, returning nil if it does not exist
+func (k CivoKubernetesInstaller) findCluster(ctx context.Context, instance InstanceDetails) (*civogo.KubernetesCluster, error) {
+    client, err := newCivoClient(ctx, k.APIKey, k.Region)
+    if err != nil {
+        return nil, err
+    }
+    return findKubernetesCluster(client, k.clusterName(instance))
+}
+
+// clusterName returns the configured cluster name, or one derived from the
+// instance's hostname so that every instance gets a cluster of its own
+func (k CivoKubernetesInstaller) clusterName(instance InstanceDetails) string {
+    switch {
+    case k.ClusterName != "":
+        return k.ClusterName
+    case instance.Name != "":
+        return "devopsmate-" + instance.Name
+    }
+    return DefaultClusterName
+}
+
+// shellQuote quotes s for safe use as a single word in a remote shell command
+func shellQuote(s string) string {
+    return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// dpkgInstalledScript returns a shell check that succeeds if the package is installed
+func dpkgInstalledScript(pkg string) string {
+    return fmt.Sprintf("dpkg-query -W -f='${Status}' %s 2>/dev/null | grep -q 'install ok installed'", shellQuote(pkg))
+}
+
+// writeFileScript returns a shell command that writes content to path as
+// root. It is a single command, so it can be chained with && on either side,
+// which a here-document cannot since its terminator must be alone on a line.
+func writeFileScript(path, content string) string {
+    return fmt.Sprintf("printf '%%s\\n' %s | sudo tee %s > /dev/null", shellQuote(content), shellQuote(path))
+}
@@ -0,0 +1,196 @@
+package pkg
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/civo/civogo"
+    "gopkg.in/yaml.v3"
+)
+
+// Inventory records the Civo resources a create run made, so they can be
+// audited and torn down later with DestroyInventory
+type Inventory struct {
+    CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
+    Region    string    `json:"region" yaml:"region"`
+    // InstanceID, InstanceName and PublicIP identify the instance
+    InstanceID   string `json:"instanceId" yaml:"instanceId"`
+    InstanceName string `json:"instanceName,omitempty" yaml:"instanceName,omitempty"`
+    PublicIP     string `json:"publicIP,omitempty" yaml:"publicIP,omitempty"`
+    // FirewallID is set when a firewall was created for the instance
+    FirewallID string `json:"firewallId,omitempty" yaml:"firewallId,omitempty"`
+    // KubernetesCluster names the cluster created by the kubernetes installer
+    KubernetesCluster string `json:"kubernetesCluster,omitempty" yaml:"kubernetesCluster,omitempty"`
+    // ObjectStores are the buckets created by the bucket command
+    ObjectStores []InventoryObjectStore `json:"objectStores,omitempty" yaml:"objectStores,omitempty"`
+}
+
+// InventoryObjectStore identifies an object store in an Inventory
+type InventoryObjectStore struct {
+    ID   string `json:"id" yaml:"id"`
+    Name string `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+// NewInventory returns the inventory of an instance returned by
+// CreateComputeInstance
+func NewInventory(details InstanceDetails) Inventory {
+    cluster := details.KubernetesCluster
+    if cluster == "" {
+        cluster = details.Outputs["kubernetes.cluster-name"]
+    }
+    return Inventory{
+        CreatedAt:         time.Now().UTC(),
+        Region:            details.Region,
+        InstanceID:        details.ID,
+        InstanceName:      details.Name,
+        PublicIP:          details.PublicIP,
+        FirewallID:        details.FirewallID,
+        KubernetesCluster: cluster,
+    }
+}
+
+// NewObjectStoreInventory returns the inventory of an object store returned
+// by CreateObjectStore
+func NewObjectStoreInventory(store ObjectStore) Inventory {
+    return Inventory{
+        CreatedAt:    time.Now().UTC(),
+        Region:       store.Region,
+        ObjectStores: []InventoryObjectStore{{ID: store.ID, Name: store.Name}},
+    }
+}
+
+// isJSONPath reports whether an inventory file should be JSON rather than YAML
+func isJSONPath(path string) bool {
+    return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// WriteInventory writes inv to path, as JSON if path ends in .json and as
+// YAML otherwise
+func WriteInventory(path string, inv Inventory) error {
+    var data []byte
+    var err error
+    if isJSONPath(path) {
+        data, err = json.MarshalIndent(inv, "", "  ")
+        data = append(data, '\n')
+    } else {
+        data, err = yaml.Marshal(inv)
+    }
+    if err != nil {
+        return fmt.Errorf("error encoding inventory: %w", err)
+    }
+    if err := os.WriteFile(path, data, 0o600); err != nil {
+        return fmt.Errorf("error writing inventory %s: %w", path, err)
+    }
+    return nil
+}
+
+// ReadInventory reads an inventory written by WriteInventory
+func ReadInventory(path string) (Inventory, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return Inventory{}, fmt.Errorf("error reading inventory %s: %w", path, err)
+    }
+    var inv Inventory
+    if isJSONPath(path) {
+        err = json.Unmarshal(data, &inv)
+    } else {
+        err = yaml.Unmarshal(data, &inv)
+    }
+    if err != nil {
+        return Inventory{}, fmt.Errorf("error parsing inventory %s: %w", path, err)
+    }
+    if inv.InstanceID == "" && inv.FirewallID == "" && inv.KubernetesCluster == "" && len(inv.ObjectStores) == 0 {
+        return Inventory{}, fmt.Errorf("inventory %s lists no resources", path)
+    }
+    return inv, nil
+}
+
+// DestroyInventory deletes the resources in inv: the object stores and the
+// Kubernetes cluster, then the instance, waiting up to timeout for it to go
+// so that the firewall is no longer in use, then the firewall. Resources that no longer exist are
+// skipped. A failure to delete one resource does not stop the others; the
+// failures are returned together.
+func DestroyInventory(apiKey string, inv Inventory, timeout time.Duration) error {
+    region := inv.Region
+    if region == "" {
+        region = DefaultRegion
+    }
+    client, err := newCivoClient(context.Background(), apiKey, region)
+    if err != nil {
+        return err
+    }
+
+    var errs []error
+    for _, store := range inv.ObjectStores {
+        if _, err := client.DeleteObjectStore(store.ID); isHTTPNotFound(err) {
+            slog.Info("object store already gone", "id", store.ID)
+        } else if err != nil {
+            errs = append(errs, fmt.Errorf("error deleting object store %s: %w", store.ID, err))
+        } else {
+            slog.Info("object store destroyed", "id", store.ID)
+        }
+    }
+
+    if inv.KubernetesCluster != "" {
+        cluster, err := findKubernetesCluster(client, inv.KubernetesCluster)
+        switch {
+        case err != nil:
+            errs = append(errs, err)
+        case cluster == nil:
+            slog.Info("Kubernetes cluster already gone", "name", inv.KubernetesCluster)
+        default:
+            if _, err := client.DeleteKubernetesCluster(cluster.ID); err != nil {
+                errs = append(errs, fmt.Errorf("error deleting Kubernetes cluster %s: %w", inv.KubernetesCluster, err))
+            } else {
+                slog.Info("Kubernetes cluster destroyed", "name", inv.KubernetesCluster)
+            }
+        }
+    }
+
+    instanceGone := true
+    if inv.InstanceID != "" {
+        err := deleteInstance(client, inv.InstanceID)
+        switch {
+        case errors.Is(err, civogo.DatabaseInstanceNotFoundError):
+            slog.Info("instance already gone", "id", inv.InstanceID)
+        case err != nil:
+            errs = append(errs, err)
+            instanceGone = false
+        default:
+            if err := waitForInstanceDeletion(client, inv.InstanceID, timeout); err != nil {
+                errs = append(errs, err)
+                instanceGone = false
+            } else {
+                slog.Info("instance destroyed", "id", inv.InstanceID)
+            }
+        }
+    }
+
+    if inv.FirewallID != "" {
+        if !instanceGone {
+            errs = append(errs, fmt.Errorf("not deleting firewall %s while instance %s may still use it", inv.FirewallID, inv.InstanceID))
+        } else if _, err := client.DeleteFirewall(inv.FirewallID); errors.Is(err, civogo.DatabaseFirewallNotFoundError) {
+            slog.Info("firewall already gone", "id", inv.FirewallID)
+        } else if err != nil {
+            errs = append(errs, fmt.Errorf("error deleting firewall %s: %w", inv.FirewallID, err))
+        } else {
+            slog.Info("firewall destroyed", "id", inv.FirewallID)
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// isHTTPNotFound reports whether err is the API answering 404 Not Found, for
+// resources civogo has no specific not-found error for
+func isHTTPNotFound(err error) bool {
+    var httpErr civogo.HTTPError
+    return errors.As(err, &httpErr) && httpErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "time"
+
+    "github.com/civo/civogo"
+)
+
+// ClusterOptions describes a Kubernetes cluster created by CreateKubernetesCluster.
+// Zero values fall back to the same defaults as CivoKubernetesInstaller.
+type ClusterOptions struct {
+    Name      string
+    NodeSize  string
+    NodeCount int
+    // PollInterval is the first delay between cluster status checks, doubling
+    // up to MaxPollInterval. Defaults to DefaultInitialPollInterval.
+    PollInterval time.Duration
+    // Timeout bounds how long to wait for the cluster to become ready. Defaults to DefaultTimeout.
+    Timeout time.Duration
+    // Created, when set, is called with the cluster's ID as soon as it has
+    // been created, before waiting for it to become ready
+    Created func(id string)
+}
+
+// CreateKubernetesCluster creates a Civo Kubernetes cluster through the API,
+// waits until it is ready and returns its kubeconfig
+func CreateKubernetesCluster(apiKey, regionCode string, opts ClusterOptions) (string, error) {
+    return CreateKubernetesClusterContext(context.Background(), apiKey, regionCode, opts)
+}
+
+// CreateKubernetesClusterContext is like CreateKubernetesCluster but also stops
+// waiting when ctx is done
+func CreateKubernetesClusterContext(ctx context.Context, apiKey, regionCode string, opts ClusterOptions) (string, error) {
+    if opts.Name == "" {
+        opts.Name = DefaultClusterName
+    }
+    if opts.NodeSize == "" {
+        opts.NodeSize = DefaultNodeSize
+    }
+    if opts.NodeCount == 0 {
+        opts.NodeCount = DefaultNodeCount
+    }
+    if opts.NodeCount < 1 {
+        return "", fmt.Errorf("node count must be at least 1, got %d", opts.NodeCount)
+    }
+    if opts.PollInterval <= 0 {
+        opts.PollInterval = DefaultInitialPollInterval
+    }
+    if opts.Timeout <= 0 {
+        opts.Timeout = DefaultTimeout
+    }
+
+    client, err := newCivoClient(ctx, apiKey, regionCode)
+    if err != nil {
+        return "", err
+    }
+
+    network, err := client.GetDefaultNetwork()
+    if err != nil {
+        return "", fmt.Errorf("error finding default network: %w", err)
+    }
+
+    slog.Info("creating Kubernetes cluster", "name", opts.Name, "nodes", opts.NodeCount, "size", opts.NodeSize)
+    cluster, err := client.NewKubernetesClusters(&civogo.KubernetesClusterConfig{
+        Name:            opts.Name,
+        Region:          regionCode,
+        NumTargetNodes:  opts.NodeCount,
+        TargetNodesSize: opts.NodeSize,
+        NetworkID:       network.ID,
+        Pools: []civogo.KubernetesClusterPoolConfig{
+            {Count: opts.NodeCount, Size: opts.NodeSize},
+        },
+    })
+    if err != nil {
+        return "", fmt.Errorf("error creating Kubernetes cluster: %w", err)
+    }
+    if opts.Created != nil {
+        opts.Created(cluster.ID)
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+    defer cancel()
+
+    interval := opts.PollInterval
+    limited := 0
+    for {
+        c, err := client.GetKubernetesCluster(cluster.ID)
+        if err != nil {
+            slog.Debug("error polling cluster status", "id", cluster.ID, "err", err)
+        } else {
+            slog.Debug("polled cluster status", "id", cluster.ID, "status", c.Status)
+        }
+        if isRateLimited(err) {
+            limited++
+            if limited >= rateLimitAttempts {
+                return "", fmt.Errorf("%w while waiting for cluster %s to become ready: %w", ErrRateLimited, opts.Name, err)
+            }
+            slog.Warn("Civo API rate limit hit, backing off", "id", cluster.ID, "retry_in", max(interval, rateLimitBackoff))
+            interval = max(interval, rateLimitBackoff)
+        } else {
+            limited = 0
+        }
+        if err == nil && c.Ready && c.KubeConfig != "" {
+            slog.Info("Kubernetes cluster is ready", "name", opts.Name)
+            return c.KubeConfig, nil
+        }
+
+        select {
+        case <-ctx.Done():
+            if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+                return "", fmt.Errorf("cluster creation timed out after %s waiting for cluster %s to become ready", opts.Timeout, opts.Name)
+            }
+            return "", fmt.Errorf("cancelled while waiting for cluster %s to become ready: %w", opts.Name, ctx.Err())
+        case <-time.After(interval):
+        }
+        interval = nextPollInterval(interval)
+    }
+}
+
+// findKubernetesCluster returns the cluster called name, or nil if there is none
+func findKubernetesCluster(client *civogo.Client, name string) (*civogo.KubernetesCluster, error) {
+    clusters, err := client.ListKubernetesClusters()
+    if err != nil {
+        return nil, fmt.Errorf("error listing Kubernetes clusters: %w", err)
+    }
+    for i := range clusters.Items {
+        if clusters.Items[i].Name == name {
+            return &clusters.Items[i], nil
+        }
+    }
+    return nil, nil
+}
@@ -0,0 +1,49 @@
+package pkg
+
+import (
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Provisioning metrics, registered with the default Prometheus registry so
+// they are served by promhttp.Handler. Dry runs are not recorded.
+var (
+    instancesCreated = promauto.NewCounter(prometheus.CounterOpts{
+        Namespace: "devopsmate",
+        Name:      "instances_created_total",
+        Help:      "Number of Civo instances created.",
+    })
+    installsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: "devopsmate",
+        Name:      "installs_total",
+        Help:      "Number of installer runs by installer and result (success, failure or skipped).",
+    }, []string{"installer", "result"})
+    provisioningDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: "devopsmate",
+        Name:      "provisioning_duration_seconds",
+        Help:      "Time taken to create an instance and run its installers, by result (success or failure).",
+        Buckets:   []float64{30, 60, 120, 300, 600, 900, 1200, 1800, 2700, 3600},
+    }, []string{"result"})
+)
+
+// recordInstallResults counts the outcome of each installer in results
+func recordInstallResults(results []InstallResult) {
+    for _, result := range results {
+        outcome := "failure"
+        switch {
+        case result.Success:
+            outcome = "success"
+        case result.Skipped:
+            outcome = "skipped"
+        }
+        installsTotal.WithLabelValues(result.Installer, outcome).Inc()
+    }
+}
+
+// resultLabel returns the result label for a run that ended with err
+func resultLabel(err error) string {
+    if err != nil {
+        return "failure"
+    }
+    return "success"
+}
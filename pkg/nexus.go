@@ -0,0 +1,148 @@
+package pkg
+
+import (
+    "context"
+    "fmt"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// Defaults for the Nexus Repository Manager installed by NexusInstaller
+const (
+    DefaultNexusVersion  = "3.70.1-02"
+    DefaultNexusHeapSize = "2703m"
+    DefaultNexusPort     = 8081
+
+    nexusHome    = "/opt/nexus"
+    nexusDataDir = "/opt/sonatype-work/nexus3"
+
+    // nexusStartTimeout is how long Nexus may take to come up after starting
+    nexusStartTimeout = 5 * time.Minute
+)
+
+// heapSizePattern matches JVM memory sizes such as 2703m or 4g
+var heapSizePattern = regexp.MustCompile(`^[0-9]+[mMgG]$`)
+
+// nexusServiceUnit runs Nexus under systemd as the nexus user
+const nexusServiceUnit = `[Unit]
+Description=Sonatype Nexus Repository Manager
+After=network.target
+
+[Service]
+Type=forking
+LimitNOFILE=65536
+User=nexus
+ExecStart=/opt/nexus/bin/nexus start
+ExecStop=/opt/nexus/bin/nexus stop
+Restart=on-abort
+
+[Install]
+WantedBy=multi-user.target`
+
+// NexusInstaller installs Sonatype Nexus Repository Manager 3 for storing
+// build artifacts such as Maven and npm packages
+type NexusInstaller struct {
+    // Version is the Nexus release, e.g. "3.70.1-02". Defaults to DefaultNexusVersion.
+    Version string
+    // HeapSize is the JVM heap, e.g. "2703m" or "4g". Defaults to DefaultNexusHeapSize.
+    HeapSize string
+    // Port serves the web UI and repositories. Defaults to DefaultNexusPort.
+    Port int
+}
+
+// Name returns "nexus"
+func (n NexusInstaller) Name() string { return "nexus" }
+
+// DependsOn returns no dependencies
+func (n NexusInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the Nexus service is set up
+func (n NexusInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, "test -x "+nexusHome+"/bin/nexus && systemctl cat nexus > /dev/null")
+}
+
+// Install downloads Nexus, applies the heap size and port and starts it as a service
+func (n NexusInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    heap := n.heapSize()
+    if !heapSizePattern.MatchString(heap) {
+        return fmt.Errorf("nexus: invalid heap size %q, expected a size such as 2703m or 4g", heap)
+    }
+    if n.Port < 0 || n.Port > 65535 {
+        return fmt.Errorf("nexus: invalid port %d", n.Port)
+    }
+
+    url := fmt.Sprintf("https://download.sonatype.com/nexus/3/nexus-%s-unix.tar.gz", n.version())
+    script := fmt.Sprintf(`sudo apt-get update &&
+sudo apt-get install -y openjdk-11-jre-headless &&
+{ id nexus > /dev/null 2>&1 || sudo useradd --system --no-create-home --shell /bin/false nexus; } &&
+curl -fsSL -o /tmp/nexus.tar.gz %[1]s &&
+sudo mkdir -p %[2]s /opt/sonatype-work &&
+sudo tar -xzf /tmp/nexus.tar.gz -C %[2]s --strip-components=1 &&
+rm -f /tmp/nexus.tar.gz &&
+sudo sed -i -e 's/^-Xms.*/-Xms%[3]s/' -e 's/^-Xmx.*/-Xmx%[3]s/' %[2]s/bin/nexus.vmoptions &&
+sudo mkdir -p %[4]s/etc &&
+echo application-port=%[5]d | sudo tee %[4]s/etc/nexus.properties > /dev/null &&
+sudo chown -R nexus:nexus %[2]s /opt/sonatype-work &&
+%[6]s &&
+sudo systemctl daemon-reload &&
+sudo systemctl enable --now nexus`,
+        shellQuote(url), nexusHome, heap, nexusDataDir, n.port(), writeFileScript("/etc/systemd/system/nexus.service", nexusServiceUnit))
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that the Nexus web UI reports it is up
+func (n NexusInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    script := fmt.Sprintf("curl -fsS -o /dev/null http://localhost:%d/service/rest/v1/status", n.port())
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// startTimeout returns how long Verify is retried for, since Nexus takes a
+// while to start
+func (n NexusInstaller) startTimeout() time.Duration { return nexusStartTimeout }
+
+// Outputs returns the generated password of the admin user under the
+// "initial-admin-password" key. Nexus deletes the file once it is changed.
+func (n NexusInstaller) Outputs(ctx context.Context, instance InstanceDetails) (map[string]string, error) {
+    out, err := readRemoteCommand(ctx, instance, "sudo cat "+nexusDataDir+"/admin.password")
+    if err != nil {
+        return nil, err
+    }
+    return map[string]string{"initial-admin-password": strings.TrimSpace(out)}, nil
+}
+
+// Uninstall stops Nexus and removes it along with its data
+func (n NexusInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo systemctl disable --now nexus;
+sudo rm -f /etc/systemd/system/nexus.service &&
+sudo systemctl daemon-reload &&
+sudo rm -rf ` + nexusHome + ` /opt/sonatype-work`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// version returns the configured version or DefaultNexusVersion
+func (n NexusInstaller) version() string {
+    if n.Version == "" {
+        return DefaultNexusVersion
+    }
+    return n.Version
+}
+
+// heapSize returns the configured heap size or DefaultNexusHeapSize
+func (n NexusInstaller) heapSize() string {
+    if n.HeapSize == "" {
+        return DefaultNexusHeapSize
+    }
+    return n.HeapSize
+}
+
+// port returns the configured port or DefaultNexusPort
+func (n NexusInstaller) port() int {
+    if n.Port == 0 {
+        return DefaultNexusPort
+    }
+    return n.Port
+}
@@ -0,0 +1,146 @@
+package pkg
+
+import (
+    "context"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// Defaults for the nginx reverse proxy installed by NginxInstaller
+const (
+    DefaultNginxListenPort = 80
+
+    nginxSitePath = "/etc/nginx/sites-available/devopsmate"
+)
+
+// nginxLocationPattern matches the URL paths NginxInstaller can route
+var nginxLocationPattern = regexp.MustCompile(`^/[A-Za-z0-9._~/-]*$`)
+
+// NginxUpstream routes requests under Path to a service on the instance
+type NginxUpstream struct {
+    // Path is the URL prefix, e.g. "/sonarqube". The service must expect it:
+    // Jenkins, for example, needs its --prefix set to match.
+    Path string
+    // Port is the local port the service listens on, e.g. 9000
+    Port int
+}
+
+// NginxInstaller installs nginx and configures it as a reverse proxy in front
+// of services installed on the instance, so they share one public port
+type NginxInstaller struct {
+    // Upstreams are the services to proxy. Empty leaves nginx's default site.
+    Upstreams []NginxUpstream
+    // ListenPort defaults to DefaultNginxListenPort
+    ListenPort int
+    // ServerName is the host name the server block answers to. Empty answers to any.
+    ServerName string
+}
+
+// Name returns "nginx"
+func (n NginxInstaller) Name() string { return "nginx" }
+
+// DependsOn returns no dependencies
+func (n NginxInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the nginx package is installed
+func (n NginxInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, dpkgInstalledScript("nginx"))
+}
+
+// Install installs nginx and, if there are upstreams, replaces the default
+// site with a proxy for them. The configuration is checked with nginx -t
+// before nginx is reloaded.
+func (n NginxInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    site, err := n.siteConfig()
+    if err != nil {
+        return err
+    }
+
+    script := `sudo apt-get update &&
+sudo apt-get install -y nginx &&
+sudo systemctl enable --now nginx`
+    if site != "" {
+        script += fmt.Sprintf(` &&
+%s &&
+sudo ln -sf %s /etc/nginx/sites-enabled/devopsmate &&
+sudo rm -f /etc/nginx/sites-enabled/default &&
+sudo nginx -t &&
+sudo systemctl reload nginx`, writeFileScript(nginxSitePath, site), nginxSitePath)
+    }
+    _, err = runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// siteConfig renders the server block for the upstreams, or returns "" if
+// there are none
+func (n NginxInstaller) siteConfig() (string, error) {
+    if len(n.Upstreams) == 0 {
+        return "", nil
+    }
+    if n.ListenPort < 0 || n.ListenPort > 65535 {
+        return "", fmt.Errorf("nginx: invalid listen port %d", n.ListenPort)
+    }
+    if strings.ContainsAny(n.ServerName, " \t\n;{}") {
+        return "", fmt.Errorf("nginx: invalid server name %q", n.ServerName)
+    }
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "server {\n    listen %d default_server;\n", n.listenPort())
+    if n.ServerName != "" {
+        fmt.Fprintf(&b, "    server_name %s;\n", n.ServerName)
+    }
+    seen := make(map[string]bool)
+    for _, upstream := range n.Upstreams {
+        if !nginxLocationPattern.MatchString(upstream.Path) {
+            return "", fmt.Errorf("nginx: invalid path %q, expected a URL path such as /jenkins", upstream.Path)
+        }
+        if upstream.Port < 1 || upstream.Port > 65535 {
+            return "", fmt.Errorf("nginx: invalid port %d for %s", upstream.Port, upstream.Path)
+        }
+        if seen[upstream.Path] {
+            return "", fmt.Errorf("nginx: path %s is mapped twice", upstream.Path)
+        }
+        seen[upstream.Path] = true
+        fmt.Fprintf(&b, `
+    location %s {
+        proxy_pass http://127.0.0.1:%d;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+`, upstream.Path, upstream.Port)
+    }
+    b.WriteString("}")
+    return b.String(), nil
+}
+
+// Verify checks the configuration with nginx -t and that nginx answers HTTP
+// requests on its listen port
+func (n NginxInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    port := n.listenPort()
+    if len(n.Upstreams) == 0 {
+        port = DefaultNginxListenPort
+    }
+    script := fmt.Sprintf("sudo nginx -t && systemctl is-active --quiet nginx && curl -sS -o /dev/null http://localhost:%d/", port)
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Uninstall removes nginx and the proxy configuration from the instance
+func (n NginxInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := fmt.Sprintf(`sudo systemctl stop nginx;
+sudo rm -f /etc/nginx/sites-enabled/devopsmate %s &&
+sudo apt-get remove --purge -y nginx nginx-common`, nginxSitePath)
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// listenPort returns the configured port or DefaultNginxListenPort
+func (n NginxInstaller) listenPort() int {
+    if n.ListenPort == 0 {
+        return DefaultNginxListenPort
+    }
+    return n.ListenPort
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "strings"
+    "time"
+
+    "github.com/civo/civogo"
+)
+
+// objectStoreSizeGB is the size requested for new object stores, Civo's minimum
+const objectStoreSizeGB = 500
+
+// ObjectStore is an object store bucket created by CreateObjectStore
+type ObjectStore struct {
+    ID       string
+    Name     string
+    Region   string
+    Endpoint string
+    // AccessKey and SecretKey are the S3 credentials of the bucket
+    AccessKey string
+    SecretKey string
+}
+
+// CreateObjectStore creates a Civo object store bucket called name, waits until
+// it is ready and returns it with its endpoint and S3 credentials. The
+// credentials are never logged. Once the bucket exists its ID is returned
+// even on error, so the caller can delete it.
+func CreateObjectStore(ctx context.Context, apiKey, region, name string) (ObjectStore, error) {
+    if region == "" {
+        region = DefaultRegion
+    }
+
+    client, err := newCivoClient(ctx, apiKey, region)
+    if err != nil {
+        return ObjectStore{}, err
+    }
+
+    slog.Info("creating object store", "name", name, "region", region)
+    store, err := client.NewObjectStore(&civogo.CreateObjectStoreRequest{
+        Name:      name,
+        MaxSizeGB: objectStoreSizeGB,
+        Region:    region,
+    })
+    if err != nil {
+        return ObjectStore{}, fmt.Errorf("error creating object store %s: %w", name, err)
+    }
+    result := ObjectStore{ID: store.ID, Name: name, Region: region}
+
+    ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+    defer cancel()
+
+    for !strings.EqualFold(store.Status, "ready") {
+        if isTerminalStatus(store.Status) {
+            return result, fmt.Errorf("object store %s entered status %s", name, store.Status)
+        }
+        select {
+        case <-ctx.Done():
+            return result, fmt.Errorf("timed out waiting for object store %s to become ready: %w", name, ctx.Err())
+        case <-time.After(DefaultPollInterval):
+        }
+
+        s, err := client.GetObjectStore(store.ID)
+        if err != nil {
+            slog.Debug("error polling object store status", "id", store.ID, "err", err)
+            continue
+        }
+        store = s
+    }
+    result.Endpoint = store.BucketURL
+    slog.Info("object store is ready", "id", store.ID, "endpoint", store.BucketURL)
+
+    credential, err := client.GetObjectStoreCredential(store.OwnerInfo.CredentialID)
+    if err != nil {
+        return result, fmt.Errorf("error getting credentials of object store %s: %w", name, err)
+    }
+    result.AccessKey = credential.AccessKeyID
+    result.SecretKey = credential.SecretAccessKeyID
+    return result, nil
+}
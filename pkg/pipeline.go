@@ -0,0 +1,186 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+)
+
+// Hook is a user callback run on the instance between pipeline steps. A hook
+// returning an error stops the pipeline.
+type Hook func(InstanceDetails) error
+
+// Hooks are the callbacks run by SetupPipeline. Nil hooks are skipped.
+type Hooks struct {
+    // BeforeProvision runs before the instance is created. Only the SSH key
+    // fields of the details are set.
+    BeforeProvision Hook
+    // AfterProvision runs once the instance is reachable over SSH
+    AfterProvision Hook
+    // BeforeInstall runs before any installer
+    BeforeInstall Hook
+    // AfterInstall runs once every installer has succeeded, with their outputs
+    AfterInstall Hook
+    // BeforeInstaller and AfterInstaller run around individual installers,
+    // keyed by installer name. AfterInstaller runs only if the installer
+    // succeeded, e.g. to run a custom script once Jenkins is up.
+    BeforeInstaller map[string]Hook
+    AfterInstaller  map[string]Hook
+}
+
+// run calls hook if it is set, naming the hook in any error it returns
+func (h Hook) run(name string, instance InstanceDetails) error {
+    if h == nil {
+        return nil
+    }
+    if err := h(instance); err != nil {
+        return fmt.Errorf("%s hook failed: %w", name, err)
+    }
+    return nil
+}
+
+// SetupPipeline provisions an instance with Provision, falling back to
+// opts.FallbackRegions if regionCode is out of capacity, and installs software
+// on it with Install, running opts.Hooks around each step. With opts.NoWait it
+// returns once the instance is accepted, skipping the hooks that follow
+// BeforeProvision and the installers.
+func SetupPipeline(ctx context.Context, apiKey, regionCode, sshKeyPath string, opts InstanceOptions) (InstanceDetails, error) {
+    hooks := opts.Hooks
+
+    // Catch installer selection mistakes before paying for an instance.
+    if !opts.SkipInstallers && !opts.NoWait {
+        if _, err := opts.Plan(); err != nil {
+            return InstanceDetails{}, err
+        }
+    }
+
+    pending := InstanceDetails{SSHKey: sshKeyPath, SSHKeyPassphrase: opts.SSHKeyPassphrase, KnownHostsFile: opts.KnownHostsFile}
+    if err := hooks.BeforeProvision.run("before provision", pending); err != nil {
+        return InstanceDetails{}, err
+    }
+    details, err := provisionWithFailover(ctx, apiKey, regionCode, sshKeyPath, opts)
+    if details.Region != "" {
+        regionCode = details.Region
+    }
+    if err != nil {
+        return details, cleanupOnCancel(ctx, apiKey, regionCode, details, opts, err)
+    }
+    if opts.NoWait {
+        return details, nil
+    }
+    if err := hooks.AfterProvision.run("after provision", details); err != nil {
+        return details, err
+    }
+
+    if err := hooks.BeforeInstall.run("before install", details); err != nil {
+        return details, err
+    }
+    details, err = Install(ctx, apiKey, regionCode, details, opts)
+    if err != nil {
+        return details, cleanupOnCancel(ctx, apiKey, regionCode, details, opts, err)
+    }
+    return details, hooks.AfterInstall.run("after install", details)
+}
+
+// cleanupOnCancel deletes the instance if the run failed because ctx was
+// cancelled, unless opts.KeepOnCancel is set. It returns err, joined with any
+// error from the delete.
+func cleanupOnCancel(ctx context.Context, apiKey, regionCode string, instance InstanceDetails, opts InstanceOptions, err error) error {
+    if !errors.Is(ctx.Err(), context.Canceled) || instance.ID == "" || opts.KeepOnCancel {
+        return err
+    }
+    if regionCode == "" {
+        regionCode = DefaultRegion
+    }
+
+    slog.Warn("run cancelled, deleting instance", "id", instance.ID)
+    if delErr := DestroyComputeInstance(apiKey, regionCode, instance.ID); delErr != nil {
+        return errors.Join(err, delErr)
+    }
+    return err
+}
+
+// InstallOnExisting runs the named installers against an instance that already
+// exists, without creating anything. PublicIP must be set, along with SSHKey,
+// Password or both.
+// Installers that call the Civo API, such as kubernetes, need credentials and
+// must be run with Install instead. Configured installers replace the
+// registered ones with the same name, as with InstanceOptions.Configured.
+func InstallOnExisting(instance InstanceDetails, installers []string, configured ...SoftwareInstaller) error {
+    if instance.PublicIP == "" || (instance.SSHKey == "" && instance.Password == "") {
+        return errors.New("PublicIP and SSHKey or Password must be set to install on an existing instance")
+    }
+    if len(installers) == 0 {
+        return errors.New("no installers selected")
+    }
+    if instance.Password == "" {
+        if _, err := loadSigner(instance.SSHKey, instance.SSHKeyPassphrase); err != nil {
+            return err
+        }
+    }
+
+    opts := InstanceOptions{Installers: installers, Configured: configured}.withDefaults()
+    if _, err := opts.Plan(); err != nil {
+        return err
+    }
+    resolved, err := opts.lookupInstallers(installers)
+    if err != nil {
+        return err
+    }
+    for _, installer := range resolved {
+        if _, ok := installer.(civoInstaller); ok {
+            return fmt.Errorf("installer %s needs Civo credentials, use Install instead", installer.Name())
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+    defer cancel()
+
+    if err := waitForSSH(ctx, instance); err != nil {
+        return err
+    }
+    _, err = Install(ctx, "", "", instance, opts)
+    return err
+}
+
+// ResumeComputeInstance continues a run that created instanceID but failed
+// part way through installing. It waits for the instance to be reachable and
+// runs the installers selected by opts, skipping those in opts.Completed.
+// Provisioning hooks are not run again.
+func ResumeComputeInstance(ctx context.Context, apiKey, regionCode, sshKeyPath, instanceID string, opts InstanceOptions) (InstanceDetails, error) {
+    opts = opts.withDefaults()
+    if regionCode == "" {
+        regionCode = DefaultRegion
+    }
+    ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+    defer cancel()
+
+    client, err := connectCivo(ctx, apiKey, regionCode)
+    if err != nil {
+        return InstanceDetails{}, err
+    }
+    inst, err := client.GetInstance(instanceID)
+    if err != nil {
+        return InstanceDetails{}, fmt.Errorf("error getting instance %s: %w", instanceID, err)
+    }
+    if inst.Status != "ACTIVE" {
+        return InstanceDetails{ID: instanceID, Name: inst.Hostname, Status: inst.Status}, fmt.Errorf("instance %s is %s, not ACTIVE", instanceID, inst.Status)
+    }
+
+    details := activeInstanceDetails(inst, sshKeyPath, opts)
+    details.Region = regionCode
+    if err := waitForSSH(ctx, details); err != nil {
+        return details, err
+    }
+    opts.progress(ctx, PhaseSSHReady, "", "instance "+details.PublicIP+" is reachable over SSH")
+
+    if err := opts.Hooks.BeforeInstall.run("before install", details); err != nil {
+        return details, err
+    }
+    details, err = Install(ctx, apiKey, regionCode, details, opts)
+    if err != nil {
+        return details, err
+    }
+    return details, opts.Hooks.AfterInstall.run("after install", details)
+}
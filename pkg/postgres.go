@@ -0,0 +1,116 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// postgresIdentifierPattern matches the database and user names
+// PostgreSQLInstaller accepts, which need no quoting
+var postgresIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// postgresBootstrapSQL creates the user and database if they do not exist yet
+// and sets the user's password. It is fed to psql with the user and database
+// variables set, after a \set of the password variable.
+const postgresBootstrapSQL = `SELECT 'CREATE ROLE ' || quote_ident(:'user') || ' LOGIN'
+    WHERE :'user' <> '' AND NOT EXISTS (SELECT FROM pg_roles WHERE rolname = :'user') \gexec
+SELECT 'ALTER ROLE ' || quote_ident(:'user') || ' PASSWORD ' || quote_literal(:'password')
+    WHERE :'user' <> '' \gexec
+SELECT 'CREATE DATABASE ' || quote_ident(:'database') || ' OWNER ' || quote_ident(coalesce(nullif(:'user', ''), 'postgres'))
+    WHERE :'database' <> '' AND NOT EXISTS (SELECT FROM pg_database WHERE datname = :'database') \gexec`
+
+// PostgreSQLInstaller installs the PostgreSQL server from the distribution's
+// packages and optionally creates a database and a user that owns it, e.g. for
+// SonarQubeInstaller's external database
+type PostgreSQLInstaller struct {
+    // Database is created if it does not exist, owned by User if one is set
+    Database string
+    // User is created with Password if it does not exist
+    User     string
+    Password string
+}
+
+// Name returns "postgresql"
+func (p PostgreSQLInstaller) Name() string { return "postgresql" }
+
+// DependsOn returns no dependencies
+func (p PostgreSQLInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the postgresql package is installed
+func (p PostgreSQLInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, dpkgInstalledScript("postgresql"))
+}
+
+// Install installs PostgreSQL, starts it and creates the database and user
+func (p PostgreSQLInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    if err := p.validate(); err != nil {
+        return err
+    }
+
+    script := `IFS= read -r PG_PASSWORD &&
+sudo apt-get update &&
+sudo DEBIAN_FRONTEND=noninteractive apt-get install -y postgresql &&
+sudo systemctl enable --now postgresql`
+    if p.Database != "" || p.User != "" {
+        script += fmt.Sprintf(` &&
+until pg_isready -q; do sleep 1; done &&
+{ printf '\\set password %%s\n' "$PG_PASSWORD"; cat <<'DEVOPSMATE_EOF'
+%s
+DEVOPSMATE_EOF
+} | sudo -u postgres psql -v ON_ERROR_STOP=1 -v user=%s -v database=%s`, postgresBootstrapSQL, shellQuote(p.User), shellQuote(p.Database))
+    }
+    // The password reaches psql as a \set line on its stdin, not as a -v
+    // argument, which ps would show
+    _, err := runRemoteCommandWithInput(ctx, instance, script, psqlQuote(p.Password)+"\n")
+    return err
+}
+
+// psqlQuote quotes s as a single-quoted psql meta-command argument, escaping
+// backslashes, quotes and line breaks so it fits on one line
+func psqlQuote(s string) string {
+    return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`).Replace(s) + "'"
+}
+
+// validate checks the database and user names, and that a user has a password
+func (p PostgreSQLInstaller) validate() error {
+    for _, name := range []string{p.Database, p.User} {
+        if name != "" && !postgresIdentifierPattern.MatchString(name) {
+            return fmt.Errorf("postgresql: invalid name %q, use letters, digits and underscores", name)
+        }
+    }
+    if (p.User == "") != (p.Password == "") {
+        return errors.New("postgresql: User and Password must be set together")
+    }
+    return nil
+}
+
+// Verify checks that the server accepts connections with pg_isready and that
+// the database exists
+func (p PostgreSQLInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    script := "pg_isready"
+    if p.Database != "" {
+        script += fmt.Sprintf(" && sudo -u postgres psql -d %s -c 'SELECT 1' > /dev/null", shellQuote(p.Database))
+    }
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Outputs returns the JDBC URL of the database, in the form SonarQubeInstaller
+// expects, under the "jdbc-url" key
+func (p PostgreSQLInstaller) Outputs(ctx context.Context, instance InstanceDetails) (map[string]string, error) {
+    if p.Database == "" {
+        return nil, nil
+    }
+    return map[string]string{"jdbc-url": "jdbc:postgresql://localhost:5432/" + p.Database}, nil
+}
+
+// Uninstall removes the PostgreSQL packages. Data under /var/lib/postgresql is kept.
+func (p PostgreSQLInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo systemctl stop postgresql;
+sudo DEBIAN_FRONTEND=noninteractive apt-get remove --purge -y postgresql postgresql-common`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
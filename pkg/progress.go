@@ -0,0 +1,42 @@
+package pkg
+
+import (
+    "context"
+    "time"
+)
+
+// Phase is a step of the provisioning pipeline reported in a ProgressEvent
+type Phase string
+
+// The phases reported by SetupPipeline, in the order they happen
+const (
+    PhaseCreating   Phase = "creating"
+    PhasePolling    Phase = "polling"
+    PhaseSSHReady   Phase = "ssh-ready"
+    PhaseInstalling Phase = "installing"
+    PhaseInstalled  Phase = "installed"
+    PhaseDone       Phase = "done"
+    PhaseFailed     Phase = "failed"
+)
+
+// ProgressEvent reports that the pipeline reached a new phase
+type ProgressEvent struct {
+    Phase Phase `json:"phase"`
+    // Installer names the installer for PhaseInstalling and PhaseInstalled
+    Installer string    `json:"installer,omitempty"`
+    Message   string    `json:"message"`
+    Time      time.Time `json:"time"`
+}
+
+// progress sends an event to opts.Progress if it is set. The send blocks until
+// the event is received or ctx is done, so events are never dropped.
+func (o InstanceOptions) progress(ctx context.Context, phase Phase, installer, message string) {
+    if o.Progress == nil {
+        return
+    }
+    event := ProgressEvent{Phase: phase, Installer: installer, Message: message, Time: time.Now()}
+    select {
+    case o.Progress <- event:
+    case <-ctx.Done():
+    }
+}
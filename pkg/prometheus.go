@@ -0,0 +1,48 @@
+package pkg
+
+import (
+    "context"
+)
+
+// PrometheusInstaller installs the Prometheus server from the Ubuntu archive
+type PrometheusInstaller struct {
+    // ScrapeConfig, if set, replaces /etc/prometheus/prometheus.yml
+    ScrapeConfig string
+}
+
+// Name returns "prometheus"
+func (p PrometheusInstaller) Name() string { return "prometheus" }
+
+// DependsOn returns no dependencies
+func (p PrometheusInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the prometheus package is installed
+func (p PrometheusInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, dpkgInstalledScript("prometheus"))
+}
+
+// Install installs Prometheus and applies the scrape config if one is set
+func (p PrometheusInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo apt-get update &&
+sudo apt-get install -y prometheus`
+    if p.ScrapeConfig != "" {
+        script += " &&\n" + writeFileScript("/etc/prometheus/prometheus.yml", p.ScrapeConfig)
+    }
+    script += " &&\nsudo systemctl enable prometheus && sudo systemctl restart prometheus"
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that Prometheus is listening and ready on port 9090
+func (p PrometheusInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "curl -fsS -o /dev/null http://localhost:9090/-/ready")
+    return err
+}
+
+// Uninstall removes Prometheus from the instance
+func (p PrometheusInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo systemctl stop prometheus;
+sudo apt-get remove --purge -y prometheus`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
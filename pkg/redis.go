@@ -0,0 +1,117 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// Defaults for the Redis server installed by RedisInstaller
+const (
+    DefaultRedisBindAddress = "127.0.0.1"
+    DefaultRedisPort        = 6379
+
+    redisConfigPath = "/etc/redis/redis.conf"
+)
+
+// RedisInstaller installs the Redis server from the distribution's packages
+type RedisInstaller struct {
+    // BindAddress is the space separated list of addresses Redis listens on.
+    // Defaults to DefaultRedisBindAddress.
+    BindAddress string
+    // Port defaults to DefaultRedisPort
+    Port int
+    // Password, if set, is required from clients through AUTH
+    Password string
+}
+
+// Name returns "redis"
+func (r RedisInstaller) Name() string { return "redis" }
+
+// DependsOn returns no dependencies
+func (r RedisInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the redis-server package is installed
+func (r RedisInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, dpkgInstalledScript("redis-server"))
+}
+
+// Install installs Redis, writes the bind address, port and password into
+// redis.conf and restarts it
+func (r RedisInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    if err := r.validate(); err != nil {
+        return err
+    }
+
+    script := fmt.Sprintf(`read -r REDIS_PASSWORD &&
+sudo apt-get update &&
+sudo apt-get install -y redis-server &&
+sudo sed -i -E '/^(bind|port|requirepass) /d' %[1]s &&
+printf 'bind %%s\nport %%d\n' %[2]s %[3]d | sudo tee -a %[1]s > /dev/null &&
+if [ -n "$REDIS_PASSWORD" ]; then printf 'requirepass "%%s"\n' "$REDIS_PASSWORD" | sudo tee -a %[1]s > /dev/null; fi &&
+sudo systemctl enable redis-server &&
+sudo systemctl restart redis-server`, redisConfigPath, shellQuote(r.bindAddress()), r.port())
+    _, err := runRemoteCommandWithInput(ctx, instance, script, r.Password+"\n")
+    return err
+}
+
+// validate checks the port and that the password can be written to redis.conf
+func (r RedisInstaller) validate() error {
+    if len(strings.Fields(r.bindAddress())) == 0 {
+        return errors.New("redis: bind address is blank")
+    }
+    if r.Port < 0 || r.Port > 65535 {
+        return fmt.Errorf("redis: invalid port %d", r.Port)
+    }
+    if strings.ContainsAny(r.Password, " \t\r\n\"'\\") {
+        return errors.New("redis: password must not contain whitespace, quotes or backslashes")
+    }
+    return nil
+}
+
+// Verify checks that Redis answers PING, authenticating if a password is set
+func (r RedisInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    script := fmt.Sprintf(`read -r REDISCLI_AUTH;
+if [ -n "$REDISCLI_AUTH" ]; then export REDISCLI_AUTH; fi;
+redis-cli -h %s -p %d ping | grep -qx PONG`, shellQuote(r.clientHost()), r.port())
+    _, err := runRemoteCommandWithInput(ctx, instance, script, r.Password+"\n")
+    return err
+}
+
+// Uninstall removes Redis from the instance
+func (r RedisInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo systemctl stop redis-server;
+sudo apt-get remove --purge -y redis-server`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// bindAddress returns the configured address or DefaultRedisBindAddress
+func (r RedisInstaller) bindAddress() string {
+    if r.BindAddress == "" {
+        return DefaultRedisBindAddress
+    }
+    return r.BindAddress
+}
+
+// port returns the configured port or DefaultRedisPort
+func (r RedisInstaller) port() int {
+    if r.Port == 0 {
+        return DefaultRedisPort
+    }
+    return r.Port
+}
+
+// clientHost returns the address to reach Redis at from the instance itself
+func (r RedisInstaller) clientHost() string {
+    hosts := strings.Fields(r.bindAddress())
+    if len(hosts) == 0 {
+        return "127.0.0.1"
+    }
+    host := hosts[0]
+    if host == "0.0.0.0" || host == "*" || host == "::" || strings.HasPrefix(host, "-") {
+        return "127.0.0.1"
+    }
+    return host
+}
@@ -0,0 +1,104 @@
+package pkg
+
+import (
+    "fmt"
+    "sort"
+    "sync"
+)
+
+var (
+    registryMu sync.RWMutex
+    registry   = make(map[string]SoftwareInstaller)
+)
+
+// defaultInstallers are the installers CreateComputeInstance runs when no
+// selection is made
+var defaultInstallers = []string{"jenkins", "sonarqube", "buildpack", "kubernetes"}
+
+func init() {
+    RegisterInstaller("jenkins", JenkinsInstaller{})
+    RegisterInstaller("sonarqube", SonarQubeInstaller{})
+    RegisterInstaller("buildpack", BuildPackInstaller{})
+    RegisterInstaller("kubernetes", CivoKubernetesInstaller{})
+    RegisterInstaller("docker", DockerInstaller{})
+    RegisterInstaller("prometheus", PrometheusInstaller{})
+    RegisterInstaller("grafana", GrafanaInstaller{})
+    RegisterInstaller("terraform", TerraformInstaller{})
+    RegisterInstaller("ansible", AnsibleInstaller{})
+    RegisterInstaller("helm", HelmInstaller{})
+    RegisterInstaller("argocd", ArgoCDInstaller{})
+    RegisterInstaller("docker-registry", DockerRegistryInstaller{})
+    RegisterInstaller("apt-packages", AptPackagesInstaller{})
+    RegisterInstaller("gitlab", GitLabInstaller{})
+    RegisterInstaller("nexus", NexusInstaller{})
+    RegisterInstaller("vault", VaultInstaller{})
+    RegisterInstaller("trivy", TrivyInstaller{})
+    RegisterInstaller("postgresql", PostgreSQLInstaller{})
+    RegisterInstaller("redis", RedisInstaller{})
+    RegisterInstaller("nginx", NginxInstaller{})
+}
+
+// RegisterInstaller makes an installer available under name. The name should
+// match inst.Name(), which is what other installers list in DependsOn.
+// It panics if name is empty, inst is nil or name is already registered.
+func RegisterInstaller(name string, inst SoftwareInstaller) {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+
+    if name == "" {
+        panic("pkg: RegisterInstaller called with an empty name")
+    }
+    if inst == nil {
+        panic("pkg: RegisterInstaller installer is nil")
+    }
+    if _, dup := registry[name]; dup {
+        panic("pkg: RegisterInstaller called twice for installer " + name)
+    }
+    registry[name] = inst
+}
+
+// LookupInstaller returns the installer registered under name
+func LookupInstaller(name string) (SoftwareInstaller, bool) {
+    registryMu.RLock()
+    defer registryMu.RUnlock()
+
+    inst, ok := registry[name]
+    return inst, ok
+}
+
+// RegisteredInstallers returns the sorted names of all registered installers
+func RegisteredInstallers() []string {
+    registryMu.RLock()
+    defer registryMu.RUnlock()
+
+    names := make([]string, 0, len(registry))
+    for name := range registry {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// installer returns the installer to run under name: the one in o.Configured
+// if there is one, otherwise the registered one
+func (o InstanceOptions) installer(name string) (SoftwareInstaller, bool) {
+    for _, inst := range o.Configured {
+        if inst.Name() == name {
+            return inst, true
+        }
+    }
+    return LookupInstaller(name)
+}
+
+// lookupInstallers resolves names against o.Configured and the registry
+func (o InstanceOptions) lookupInstallers(names []string) ([]SoftwareInstaller, error) {
+    installers := make([]SoftwareInstaller, 0, len(names))
+    for _, name := range names {
+        inst, ok := o.installer(name)
+        if !ok {
+            return nil, fmt.Errorf("unknown installer %q", name)
+        }
+        installers = append(installers, inst)
+    }
+    return installers, nil
+}
@@ -0,0 +1,140 @@
+package pkg
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "slices"
+    "strings"
+
+    "golang.org/x/crypto/ssh"
+)
+
+// Runner executes installer scripts on an instance. Installers never talk to
+// the instance directly, so a Runner that records scripts instead of running
+// them shows exactly what an installer would do without a live host.
+type Runner interface {
+    // Run runs script on the instance with input on its stdin, copying its
+    // combined stdout and stderr to stream as it arrives, and returns that
+    // output. A script that exits non-zero must return an error that wraps
+    // one with an ExitStatus() int method, such as *ssh.ExitError, so that
+    // checks can tell a failed command from a failed connection. The
+    // variables in instance.Env must be exported to the script, and
+    // instance.SudoPassword, HomeDir and WorkDir honoured.
+    Run(ctx context.Context, instance InstanceDetails, script, input string, stream io.Writer) (string, error)
+}
+
+// SSHRunner runs scripts on the instance over SSH. It is the default Runner.
+type SSHRunner struct{}
+
+// Run runs script over SSH, returning a *CommandError if it fails
+func (SSHRunner) Run(ctx context.Context, instance InstanceDetails, script, input string, stream io.Writer) (string, error) {
+    slog.Debug("running remote command", "host", instance.PublicIP, "user", instance.sshUser(), "env", redactedEnv(instance.Env), "script", script)
+    client, err := dialSSH(ctx, instance)
+    if err != nil {
+        return "", err
+    }
+    defer client.Close()
+
+    session, err := client.NewSession()
+    if err != nil {
+        return "", fmt.Errorf("error opening SSH session: %w", err)
+    }
+    defer session.Close()
+
+    var output bytes.Buffer
+    w := &lockedWriter{w: io.MultiWriter(&output, stream)}
+    session.Stdout = w
+    session.Stderr = w
+    session.Stdin = strings.NewReader(remoteInput(instance, input))
+
+    done := make(chan error, 1)
+    go func() {
+        done <- session.Run(remoteScript(instance, instance.Env, script))
+    }()
+
+    select {
+    case err := <-done:
+        if err != nil {
+            return output.String(), &CommandError{Output: output.String(), Err: err}
+        }
+        return output.String(), nil
+    case <-ctx.Done():
+        session.Signal(ssh.SIGKILL)
+        return "", ctx.Err()
+    }
+}
+
+// dryRunRunner prints scripts to the instance's output instead of running them
+type dryRunRunner struct{}
+
+// Run prints the script and reports success. Input is never printed since it
+// is used to pass secrets, and nor are secret environment variables.
+func (dryRunRunner) Run(ctx context.Context, instance InstanceDetails, script, input string, stream io.Writer) (string, error) {
+    fmt.Fprintf(instance.output(), "[dry-run] would run:\n%s\n", remoteScript(instance, redactedEnv(instance.Env), script))
+    return "", nil
+}
+
+// remoteScript prefixes script with the setup the instance asks for: $HOME,
+// the working directory, the variables in env and a sudo wrapper. Since
+// installers run most commands through sudo, which resets the environment,
+// the wrapper keeps env. With a SudoPassword it reads the password from the
+// first line of stdin and has sudo ask for it through SUDO_ASKPASS, leaving
+// stdin free for the script and for commands piped into sudo.
+func remoteScript(instance InstanceDetails, env map[string]string, script string) string {
+    var b strings.Builder
+    if instance.SudoPassword != "" {
+        b.WriteString(`IFS= read -r DEVOPSMATE_SUDO_PASSWORD && export DEVOPSMATE_SUDO_PASSWORD &&
+SUDO_ASKPASS=$(mktemp) && export SUDO_ASKPASS && trap 'rm -f "$SUDO_ASKPASS"' EXIT &&
+printf '#!/bin/sh\nprintf "%%s\\n" "$DEVOPSMATE_SUDO_PASSWORD"\n' > "$SUDO_ASKPASS" && chmod 700 "$SUDO_ASKPASS" || exit 1
+`)
+    }
+    if instance.HomeDir != "" {
+        fmt.Fprintf(&b, "export HOME=%s\n", shellQuote(instance.HomeDir))
+    }
+    if instance.WorkDir != "" {
+        dir := shellQuote(instance.WorkDir)
+        fmt.Fprintf(&b, "mkdir -p %s && cd %s || exit 1\n", dir, dir)
+    }
+    b.WriteString(envScript(env))
+
+    var flags []string
+    if len(env) > 0 {
+        names := make([]string, 0, len(env))
+        for name := range env {
+            names = append(names, name)
+        }
+        slices.Sort(names)
+        flags = append(flags, "--preserve-env="+strings.Join(names, ","))
+    }
+    if instance.SudoPassword != "" {
+        flags = append(flags, "-A")
+    }
+    if len(flags) > 0 {
+        fmt.Fprintf(&b, "sudo() { command sudo %s \"$@\"; }\n", strings.Join(flags, " "))
+    }
+    return b.String() + script
+}
+
+// remoteInput returns the stdin for a script wrapped by remoteScript: the
+// SudoPassword on the first line, if there is one, followed by input
+func remoteInput(instance InstanceDetails, input string) string {
+    if instance.SudoPassword != "" {
+        return instance.SudoPassword + "\n" + input
+    }
+    return input
+}
+
+// runner returns the Runner for the instance: a dry-run printer if DryRun is
+// set, otherwise Runner, falling back to SSHRunner
+func (i InstanceDetails) runner() Runner {
+    switch {
+    case i.DryRun:
+        return dryRunRunner{}
+    case i.Runner != nil:
+        return i.Runner
+    }
+    return SSHRunner{}
+}
@@ -0,0 +1,385 @@
+package pkg
+
+import (
+    "context"
+    "io"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// runnerCall is a script run through a recordingRunner
+type runnerCall struct {
+    Instance InstanceDetails
+    Script   string
+    Input    string
+}
+
+// recordingRunner records the scripts installers run instead of running them
+type recordingRunner struct {
+    mu    sync.Mutex
+    calls []runnerCall
+    // errs are returned for the given scripts
+    errs map[string]error
+}
+
+func (r *recordingRunner) Run(ctx context.Context, instance InstanceDetails, script, input string, stream io.Writer) (string, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.calls = append(r.calls, runnerCall{Instance: instance, Script: script, Input: input})
+    return "", r.errs[script]
+}
+
+// ran reports whether script was run
+func (r *recordingRunner) ran(script string) bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for _, call := range r.calls {
+        if call.Script == script {
+            return true
+        }
+    }
+    return false
+}
+
+// scripts returns the recorded scripts joined into one, for matching
+func (r *recordingRunner) scripts() string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    scripts := make([]string, len(r.calls))
+    for i, call := range r.calls {
+        scripts[i] = call.Script
+    }
+    return strings.Join(scripts, "\n")
+}
+
+// inputs returns the recorded stdin of every script joined into one
+func (r *recordingRunner) inputs() string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    inputs := make([]string, len(r.calls))
+    for i, call := range r.calls {
+        inputs[i] = call.Input
+    }
+    return strings.Join(inputs, "\n")
+}
+
+func TestRemoteScript(t *testing.T) {
+    tests := []struct {
+        name     string
+        instance InstanceDetails
+        env      map[string]string
+        want     []string
+        notWant  []string
+    }{
+        {
+            name:    "plain",
+            want:    []string{"echo hi"},
+            notWant: []string{"sudo()", "SUDO_ASKPASS", "export"},
+        },
+        {
+            name: "env",
+            env:  map[string]string{"B": "two words", "A": "it's"},
+            want: []string{
+                "export A='it'\\''s'\nexport B='two words'\n",
+                "sudo() { command sudo --preserve-env=A,B \"$@\"; }\n",
+            },
+            notWant: []string{"SUDO_ASKPASS", "-A \"$@\""},
+        },
+        {
+            name:     "sudo password",
+            instance: InstanceDetails{SudoPassword: "s3cret"},
+            want: []string{
+                "IFS= read -r DEVOPSMATE_SUDO_PASSWORD",
+                "SUDO_ASKPASS=$(mktemp)",
+                "sudo() { command sudo -A \"$@\"; }\n",
+            },
+            notWant: []string{"s3cret", "--preserve-env"},
+        },
+        {
+            name:     "env and sudo password",
+            instance: InstanceDetails{SudoPassword: "s3cret"},
+            env:      map[string]string{"HTTPS_PROXY": "http://proxy:3128"},
+            want: []string{
+                "export HTTPS_PROXY='http://proxy:3128'\n",
+                "sudo() { command sudo --preserve-env=HTTPS_PROXY -A \"$@\"; }\n",
+            },
+            notWant: []string{"s3cret"},
+        },
+        {
+            name:     "home and work directory",
+            instance: InstanceDetails{HomeDir: "/home/ci", WorkDir: "/srv/build dir"},
+            want: []string{
+                "export HOME='/home/ci'\n",
+                "mkdir -p '/srv/build dir' && cd '/srv/build dir' || exit 1\n",
+            },
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            script := remoteScript(tt.instance, tt.env, "echo hi")
+            if !strings.HasSuffix(script, "echo hi") {
+                t.Errorf("script does not end with the installer's script:\n%s", script)
+            }
+            for _, want := range tt.want {
+                if !strings.Contains(script, want) {
+                    t.Errorf("script does not contain %q:\n%s", want, script)
+                }
+            }
+            for _, notWant := range tt.notWant {
+                if strings.Contains(script, notWant) {
+                    t.Errorf("script contains %q:\n%s", notWant, script)
+                }
+            }
+        })
+    }
+}
+
+func TestRemoteInput(t *testing.T) {
+    if got := remoteInput(InstanceDetails{}, "data"); got != "data" {
+        t.Errorf("without a sudo password got %q, want the input unchanged", got)
+    }
+    if got := remoteInput(InstanceDetails{SudoPassword: "s3cret"}, "data"); got != "s3cret\ndata" {
+        t.Errorf("with a sudo password got %q, want it on the first line", got)
+    }
+}
+
+// TestRemoteScriptRuns runs wrapped scripts with a local shell, the way
+// SSHRunner runs them on the instance, with a fake sudo that prints its
+// arguments, the variables it was asked to keep, and the askpass answer
+func TestRemoteScriptRuns(t *testing.T) {
+    bash, err := exec.LookPath("bash")
+    if err != nil {
+        t.Skip("bash not found")
+    }
+    bin := t.TempDir()
+    fakeSudo := `#!/bin/sh
+echo "args: $*"
+echo "proxy: $HTTPS_PROXY"
+if [ -n "$SUDO_ASKPASS" ]; then echo "askpass: $("$SUDO_ASKPASS")"; fi
+`
+    if err := os.WriteFile(filepath.Join(bin, "sudo"), []byte(fakeSudo), 0o755); err != nil {
+        t.Fatal(err)
+    }
+    env := map[string]string{"HTTPS_PROXY": "http://proxy:3128"}
+
+    tests := []struct {
+        name     string
+        instance InstanceDetails
+        want     string
+    }{
+        {
+            name: "without sudo password",
+            want: "args: --preserve-env=HTTPS_PROXY true\nproxy: http://proxy:3128\nstdin: data\n",
+        },
+        {
+            name:     "with sudo password",
+            instance: InstanceDetails{SudoPassword: "it's s3cret"},
+            want:     "args: --preserve-env=HTTPS_PROXY -A true\nproxy: http://proxy:3128\naskpass: it's s3cret\nstdin: data\n",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cmd := exec.Command(bash, "-c", remoteScript(tt.instance, env, `sudo true && echo "stdin: $(cat)"`))
+            cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+            cmd.Stdin = strings.NewReader(remoteInput(tt.instance, "data"))
+            out, err := cmd.CombinedOutput()
+            if err != nil {
+                t.Fatalf("script failed: %v\n%s", err, out)
+            }
+            if string(out) != tt.want {
+                t.Errorf("got output\n%s\nwant\n%s", out, tt.want)
+            }
+        })
+    }
+}
+
+func TestInstallerScripts(t *testing.T) {
+    bash, _ := exec.LookPath("bash")
+    tests := []struct {
+        installer SoftwareInstaller
+        install   []string
+        verify    []string
+        uninstall []string
+        // secret must reach the instance on stdin, never in a script
+        secret string
+    }{
+        {
+            installer: JenkinsInstaller{Version: "2.440.3", Plugins: []string{"git"}},
+            install:   []string{"sudo apt-get install -y jenkins='2.440.3'", "'git'"},
+            verify:    []string{"systemctl is-active --quiet jenkins", "http://localhost:8080/login"},
+            uninstall: []string{"sudo apt-get remove --purge -y jenkins"},
+        },
+        {
+            installer: SonarQubeInstaller{JDBCURL: "jdbc:postgresql://db/sonar", JDBCUsername: "sonar", JDBCPassword: "jdbc-s3cret"},
+            install:   []string{"sudo sysctl -w vm.max_map_count=262144", "sudo apt-get install -y sonarqube", "read -r JDBC_PASSWORD"},
+            verify:    []string{"sysctl -n vm.max_map_count", "http://localhost:9000/api/system/status"},
+            uninstall: []string{"sudo apt-get remove --purge -y sonarqube"},
+            secret:    "jdbc-s3cret",
+        },
+        {
+            installer: BuildPackInstaller{},
+            install:   []string{"pack-v", "sudo tar -C /usr/local/bin/"},
+            verify:    []string{"pack version"},
+            uninstall: []string{"sudo rm -f /usr/local/bin/pack"},
+        },
+        {
+            installer: DockerInstaller{},
+            install:   []string{"https://get.docker.com", "sudo systemctl enable --now docker"},
+            verify:    []string{"sudo docker info"},
+            uninstall: []string{"sudo apt-get remove --purge -y docker-ce"},
+        },
+        {
+            installer: AptPackagesInstaller{Packages: []string{"git", "jq"}},
+            install:   []string{"apt-get install -y 'git' 'jq'"},
+            verify:    []string{"dpkg-query -W -f='${Status}' 'git'", "'jq'"},
+            uninstall: []string{"sudo apt-get remove --purge -y 'git' 'jq'"},
+        },
+        {
+            installer: NexusInstaller{},
+            install:   []string{"nexus-3.70.1-02-unix.tar.gz", "sudo tee '/etc/systemd/system/nexus.service'", "sudo systemctl enable --now nexus"},
+            verify:    []string{"http://localhost:8081/service/rest/v1/status"},
+            uninstall: []string{"sudo rm -rf /opt/nexus /opt/sonatype-work"},
+        },
+        {
+            installer: VaultInstaller{},
+            install:   []string{"sudo apt-get install -y vault", "sudo tee '/etc/vault.d/vault.hcl'", "sudo systemctl restart vault"},
+            verify:    []string{"vault status"},
+            uninstall: []string{"sudo apt-get remove --purge -y vault"},
+        },
+        {
+            installer: PostgreSQLInstaller{Database: "app", User: "app", Password: "pg-s3cret"},
+            install:   []string{"read -r PG_PASSWORD", "apt-get install -y postgresql"},
+            verify:    []string{"pg_isready"},
+            uninstall: []string{"apt-get remove --purge -y postgresql"},
+            secret:    "pg-s3cret",
+        },
+        {
+            installer: RedisInstaller{Password: "redis-s3cret"},
+            install:   []string{"read -r REDIS_PASSWORD", "sudo apt-get install -y redis-server"},
+            verify:    []string{"redis-cli -h '127.0.0.1' -p 6379 ping"},
+            uninstall: []string{"sudo apt-get remove --purge -y redis-server"},
+            secret:    "redis-s3cret",
+        },
+        {
+            installer: AnsibleInstaller{Version: "10.5.0"},
+            install:   []string{"pipx install --include-deps 'ansible==10.5.0'"},
+            verify:    []string{"ansible --version && sudo PIPX_HOME=/opt/pipx PIPX_BIN_DIR=/usr/local/bin pipx list --short | grep -qxF 'ansible 10.5.0'"},
+            uninstall: []string{"pipx uninstall ansible"},
+        },
+        {
+            installer: DockerRegistryInstaller{Username: "ci", Password: "registry-s3cret"},
+            install:   []string{"read -r REGISTRY_PASSWORD", "htpasswd", "{ sudo docker rm -f devopsmate-registry > /dev/null 2>&1 || true; } &&\nsudo docker run", "registry:2"},
+            verify:    []string{"http://localhost:5000/v2/"},
+            uninstall: []string{"sudo docker rm -f devopsmate-registry"},
+            secret:    "registry-s3cret",
+        },
+        {
+            installer: GrafanaInstaller{AdminPassword: "grafana-s3cret"},
+            install:   []string{"read -r GRAFANA_PASSWORD", "sudo apt-get install -y grafana", "reset-admin-password --password-from-stdin"},
+            verify:    []string{"http://localhost:3000/api/health"},
+            uninstall: []string{"sudo apt-get remove --purge -y grafana"},
+            secret:    "grafana-s3cret",
+        },
+        {
+            installer: PrometheusInstaller{ScrapeConfig: "scrape_configs: []"},
+            install:   []string{"sudo apt-get install -y prometheus", "sudo tee '/etc/prometheus/prometheus.yml'", "sudo systemctl restart prometheus"},
+            verify:    []string{"http://localhost:9090/-/ready"},
+            uninstall: []string{"sudo apt-get remove --purge -y prometheus"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.installer.Name(), func(t *testing.T) {
+            for _, step := range []struct {
+                name string
+                run  func(context.Context, InstanceDetails) error
+                want []string
+            }{
+                {"Install", tt.installer.Install, tt.install},
+                {"Verify", tt.installer.Verify, tt.verify},
+                {"Uninstall", tt.installer.Uninstall, tt.uninstall},
+            } {
+                runner := &recordingRunner{}
+                instance := InstanceDetails{PublicIP: "203.0.113.10", Runner: runner, Output: io.Discard}
+                if err := step.run(context.Background(), instance); err != nil {
+                    t.Fatalf("%s: %v", step.name, err)
+                }
+                script := runner.scripts()
+                if script == "" {
+                    t.Fatalf("%s ran nothing", step.name)
+                }
+                for _, want := range step.want {
+                    if !strings.Contains(script, want) {
+                        t.Errorf("%s script does not contain %q:\n%s", step.name, want, script)
+                    }
+                }
+                if tt.secret != "" && strings.Contains(script, tt.secret) {
+                    t.Errorf("%s script contains the secret:\n%s", step.name, script)
+                }
+                if tt.secret != "" && step.name == "Install" && !strings.Contains(runner.inputs(), tt.secret) {
+                    t.Errorf("Install did not pass the secret on stdin")
+                }
+                if bash != "" {
+                    // Catches broken quoting and unterminated here-documents
+                    out, err := exec.Command(bash, "-n", "-c", script).CombinedOutput()
+                    if err != nil || len(out) > 0 {
+                        t.Errorf("%s script is not valid shell: %v %s\n%s", step.name, err, out, script)
+                    }
+                }
+            }
+        })
+    }
+}
+
+// TestInstallerScriptsWrapped checks that an installer's script reaches the
+// Runner unwrapped, along with the instance settings the Runner must apply
+func TestInstallerScriptsWrapped(t *testing.T) {
+    for _, sudoPassword := range []string{"", "s3cret"} {
+        runner := &recordingRunner{}
+        instance := InstanceDetails{
+            Runner:       runner,
+            Output:       io.Discard,
+            Env:          map[string]string{"HTTPS_PROXY": "http://proxy:3128"},
+            SudoPassword: sudoPassword,
+        }
+        if err := (DockerInstaller{}).Install(context.Background(), instance); err != nil {
+            t.Fatal(err)
+        }
+        if len(runner.calls) != 1 {
+            t.Fatalf("ran %d scripts, want 1", len(runner.calls))
+        }
+        call := runner.calls[0]
+        if strings.Contains(call.Script, "sudo()") || strings.Contains(call.Script, "export HTTPS_PROXY") {
+            t.Errorf("installer wrapped its own script:\n%s", call.Script)
+        }
+        if call.Instance.Env["HTTPS_PROXY"] != "http://proxy:3128" || call.Instance.SudoPassword != sudoPassword {
+            t.Errorf("runner got env %v and sudo password %q, want the instance's", call.Instance.Env, call.Instance.SudoPassword)
+        }
+
+        wrapped := remoteScript(call.Instance, call.Instance.Env, call.Script)
+        wantSudo := "sudo() { command sudo --preserve-env=HTTPS_PROXY \"$@\"; }"
+        if sudoPassword != "" {
+            wantSudo = "sudo() { command sudo --preserve-env=HTTPS_PROXY -A \"$@\"; }"
+        }
+        if !strings.Contains(wrapped, wantSudo) || !strings.HasSuffix(wrapped, call.Script) {
+            t.Errorf("with sudo password %q, wrapped script does not define %q before the script:\n%s", sudoPassword, wantSudo, wrapped)
+        }
+        if sudoPassword != "" && strings.Contains(wrapped, sudoPassword) {
+            t.Errorf("wrapped script contains the sudo password:\n%s", wrapped)
+        }
+    }
+}
+
+func TestGitLabDryRun(t *testing.T) {
+    var out strings.Builder
+    instance := InstanceDetails{DryRun: true, Output: &out}
+    if err := (GitLabInstaller{}).Install(context.Background(), instance); err != nil {
+        t.Fatalf("Install: %v", err)
+    }
+    if !strings.Contains(out.String(), "EXTERNAL_URL='http://<public-ip>'") {
+        t.Errorf("dry run does not use the public IP placeholder:\n%s", out.String())
+    }
+}
@@ -0,0 +1,476 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net"
+    "slices"
+    "strings"
+    "sync"
+    "time"
+)
+
+// InstallResult records the outcome of one installer in a run
+type InstallResult struct {
+    Installer string `json:"installer"`
+    // Success is true when the software was installed, or already present,
+    // and passed verification
+    Success bool `json:"success"`
+    // Skipped is true when Install was not run, because the software was
+    // already present or a dependency failed
+    Skipped  bool          `json:"skipped,omitempty"`
+    Duration time.Duration `json:"duration"`
+    Error    string        `json:"error,omitempty"`
+}
+
+// retryBackoff is the delay before the first retry of a transient failure.
+// It is a variable so that tests can shorten it.
+var retryBackoff = 2 * time.Second
+
+// runInstallers installs the installers in dependency order. Installers whose
+// dependencies are all satisfied run concurrently, at most parallelism at a
+// time. An install failure stops before dependent installers run; verification
+// failures are collected and returned together once everything has run.
+// Values reported by installers implementing OutputProvider are returned
+// keyed by "<installer>.<key>". Software that is already present is not
+// reinstalled unless opts.Force is set. Each install is bounded by
+// opts.InstallerTimeout. With opts.ContinueOnError, or opts.ContinueOnTimeout
+// for timeouts, a failed install is reported alongside the other errors and
+// only its dependents are skipped instead of stopping the run. The outcome
+// of every installer that was started or skipped is returned as an InstallResult.
+// opts.Hooks.BeforeInstaller and AfterInstaller run around each installer.
+func runInstallers(ctx context.Context, instance InstanceDetails, installers []SoftwareInstaller, opts InstanceOptions) (map[string]string, []InstallResult, error) {
+    stages, err := planStages(installers)
+    if err != nil {
+        return nil, nil, err
+    }
+    parallelism := opts.Parallelism
+    if parallelism < 1 {
+        parallelism = 1
+    }
+
+    var (
+        mu      sync.Mutex
+        runErrs []error
+        outputs = make(map[string]string)
+        results = make(map[string]InstallResult)
+        // failed holds installers that failed without stopping the run, under
+        // ContinueOnError or ContinueOnTimeout, and those skipped because they
+        // depend on one
+        failed = make(map[string]bool)
+    )
+    for _, stage := range stages {
+        var (
+            wg          sync.WaitGroup
+            installErrs []error
+        )
+        sem := make(chan struct{}, parallelism)
+
+        for _, installer := range stage {
+            mu.Lock()
+            dep, skip := failedDependency(installer, failed)
+            if skip {
+                err := fmt.Errorf("skipped %s: dependency %s failed", installer.Name(), dep)
+                failed[installer.Name()] = true
+                runErrs = append(runErrs, err)
+                results[installer.Name()] = InstallResult{Installer: installer.Name(), Skipped: true, Error: err.Error()}
+            }
+            mu.Unlock()
+            if skip {
+                slog.Warn("skipping installer, a dependency failed", "installer", installer.Name(), "dependency", dep)
+                continue
+            }
+
+            wg.Add(1)
+            sem <- struct{}{}
+            go func() {
+                defer wg.Done()
+                defer func() { <-sem }()
+
+                instance := instance
+                instance.Env = opts.installerEnv(installer.Name())
+
+                result := InstallResult{Installer: installer.Name()}
+                start := time.Now()
+                defer func() {
+                    result.Duration = time.Since(start)
+                    mu.Lock()
+                    results[installer.Name()] = result
+                    mu.Unlock()
+                }()
+
+                // Installers completed by an earlier run are only verified.
+                completed := slices.Contains(opts.Completed, installer.Name())
+                installCtx, cancel := installerContext(ctx, opts.InstallerTimeout)
+                var err error
+                if !completed {
+                    err = opts.Hooks.BeforeInstaller[installer.Name()].run("before "+installer.Name(), instance)
+                }
+                ran := false
+                if err == nil && !completed {
+                    ran, err = install(installCtx, instance, installer, opts)
+                }
+                timedOut := errors.Is(installCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+                cancel()
+                if err != nil {
+                    mu.Lock()
+                    defer mu.Unlock()
+                    if timedOut {
+                        slog.Warn("installer timed out", "installer", installer.Name(), "timeout", opts.InstallerTimeout)
+                        err = &InstallerError{Name: installer.Name(), Err: fmt.Errorf("installer %s timed out after %s: %w", installer.Name(), opts.InstallerTimeout, err)}
+                    } else {
+                        err = &InstallerError{Name: installer.Name(), Err: fmt.Errorf("error installing %s: %w", installer.Name(), err)}
+                    }
+                    result.Error = err.Error()
+                    if opts.ContinueOnError || (timedOut && opts.ContinueOnTimeout) {
+                        failed[installer.Name()] = true
+                        runErrs = append(runErrs, err)
+                        return
+                    }
+                    installErrs = append(installErrs, err)
+                    return
+                }
+                result.Skipped = !ran
+                if err := verify(ctx, instance, installer, verifyTimeout(installer, opts.VerifyTimeout)); err != nil {
+                    err = &InstallerError{Name: installer.Name(), Err: fmt.Errorf("error verifying %s: %w", installer.Name(), err)}
+                    result.Error = err.Error()
+                    mu.Lock()
+                    runErrs = append(runErrs, err)
+                    mu.Unlock()
+                    return
+                }
+
+                if provider, ok := installer.(OutputProvider); ok {
+                    values, err := provider.Outputs(ctx, instance)
+                    mu.Lock()
+                    if err != nil {
+                        err = &InstallerError{Name: installer.Name(), Err: fmt.Errorf("error reading outputs of %s: %w", installer.Name(), err)}
+                        result.Error = err.Error()
+                        runErrs = append(runErrs, err)
+                        mu.Unlock()
+                        return
+                    }
+                    for key, value := range values {
+                        outputs[installer.Name()+"."+key] = value
+                    }
+                    mu.Unlock()
+                }
+
+                if completed {
+                    result.Success = true
+                    return
+                }
+                if err := opts.Hooks.AfterInstaller[installer.Name()].run("after "+installer.Name(), instance); err != nil {
+                    result.Error = err.Error()
+                    mu.Lock()
+                    runErrs = append(runErrs, err)
+                    mu.Unlock()
+                    return
+                }
+                result.Success = true
+            }()
+        }
+        wg.Wait()
+
+        if len(installErrs) > 0 {
+            return outputs, orderResults(installers, results), errors.Join(installErrs...)
+        }
+    }
+    return outputs, orderResults(installers, results), errors.Join(runErrs...)
+}
+
+// orderResults returns the recorded results in the order the installers were
+// given, leaving out installers that never ran
+func orderResults(installers []SoftwareInstaller, results map[string]InstallResult) []InstallResult {
+    ordered := make([]InstallResult, 0, len(results))
+    for _, installer := range installers {
+        if result, ok := results[installer.Name()]; ok {
+            ordered = append(ordered, result)
+        }
+    }
+    return ordered
+}
+
+// installerContext derives the context a single installer runs under, bounded
+// by timeout when it is positive
+func installerContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+    if timeout <= 0 {
+        return context.WithCancel(ctx)
+    }
+    return context.WithTimeout(ctx, timeout)
+}
+
+// failedDependency returns the first dependency of installer recorded in failed
+func failedDependency(installer SoftwareInstaller, failed map[string]bool) (string, bool) {
+    for _, dep := range installer.DependsOn() {
+        if failed[dep] {
+            return dep, true
+        }
+    }
+    return "", false
+}
+
+// install runs the installer unless the software is already present and
+// opts.Force is unset, retrying transient failures up to opts.MaxAttempts
+// times. It reports whether Install was run.
+func install(ctx context.Context, instance InstanceDetails, installer SoftwareInstaller, opts InstanceOptions) (bool, error) {
+    if !opts.Force && !instance.DryRun {
+        installed, err := installer.IsInstalled(ctx, instance)
+        if err != nil {
+            return false, fmt.Errorf("error checking for existing install: %w", err)
+        }
+        if installed {
+            slog.Info("already installed, skipping", "installer", installer.Name())
+            return false, nil
+        }
+    }
+
+    slog.Info("installing", "installer", installer.Name())
+    opts.progress(ctx, PhaseInstalling, installer.Name(), "installing "+installer.Name())
+    err := retryTransient(ctx, opts.MaxAttempts, func() error {
+        return installer.Install(ctx, instance)
+    })
+    if err == nil {
+        slog.Info("installed", "installer", installer.Name())
+        opts.progress(ctx, PhaseInstalled, installer.Name(), "installed "+installer.Name())
+    }
+    return true, err
+}
+
+// verify calls the installer's Verify until it succeeds or timeout has passed,
+// backing off between tries, since services often take a while to start after
+// they are installed. A try already running when timeout passes is allowed to
+// finish. Dry runs are verified once.
+func verify(ctx context.Context, instance InstanceDetails, installer SoftwareInstaller, timeout time.Duration) error {
+    deadline := time.Now().Add(timeout)
+    backoff := retryBackoff
+    for {
+        err := installer.Verify(ctx, instance)
+        if err == nil || instance.DryRun {
+            return err
+        }
+        wait := min(backoff, time.Until(deadline))
+        if wait <= 0 {
+            return err
+        }
+        slog.Debug("not ready yet, verifying again", "installer", installer.Name(), "retry_in", wait, "err", err)
+
+        select {
+        case <-ctx.Done():
+            return err
+        case <-time.After(wait):
+        }
+        backoff = nextPollInterval(backoff)
+    }
+}
+
+// slowStarter is implemented by installers whose software can take longer
+// to start than DefaultVerifyTimeout allows
+type slowStarter interface {
+    startTimeout() time.Duration
+}
+
+// verifyTimeout returns how long to keep verifying installer: timeout, or
+// the installer's own start timeout if that is longer
+func verifyTimeout(installer SoftwareInstaller, timeout time.Duration) time.Duration {
+    if s, ok := installer.(slowStarter); ok {
+        return max(timeout, s.startTimeout())
+    }
+    return timeout
+}
+
+// retryTransient calls fn until it succeeds, fails with an error that is not
+// transient, or has been tried attempts times, backing off exponentially
+// between tries
+func retryTransient(ctx context.Context, attempts int, fn func() error) error {
+    backoff := retryBackoff
+    for attempt := 1; ; attempt++ {
+        err := fn()
+        if err == nil || attempt >= attempts || !isTransient(err) {
+            return err
+        }
+        slog.Warn("transient failure, retrying", "attempt", attempt, "retry_in", backoff, "err", err)
+
+        select {
+        case <-ctx.Done():
+            return err
+        case <-time.After(backoff):
+        }
+        backoff *= 2
+    }
+}
+
+// isTransient reports whether err looks like a temporary network or locking
+// problem that is worth retrying, as opposed to a permanent failure such as a
+// missing package
+func isTransient(err error) bool {
+    if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+        return false
+    }
+
+    var cmdErr *CommandError
+    if errors.As(err, &cmdErr) {
+        for _, marker := range permanentMarkers {
+            if strings.Contains(cmdErr.Output, marker) {
+                return false
+            }
+        }
+        for _, marker := range transientMarkers {
+            if strings.Contains(cmdErr.Output, marker) {
+                return true
+            }
+        }
+        return false
+    }
+
+    var netErr net.Error
+    return errors.As(err, &netErr)
+}
+
+var (
+    // transientMarkers are output fragments of failures that usually go away on retry
+    transientMarkers = []string{
+        "Temporary failure resolving",
+        "Could not resolve",
+        "Failed to fetch",
+        "Connection timed out",
+        "Connection reset by peer",
+        "Could not get lock",
+        "Unable to acquire the dpkg frontend lock",
+    }
+    // permanentMarkers are output fragments of failures that retrying cannot fix
+    permanentMarkers = []string{
+        "Unable to locate package",
+        "has no installation candidate",
+        "is not available",
+    }
+)
+
+// ValidatePlan checks that the named installers exist and that their
+// dependencies are all selected and free of cycles, without connecting to
+// anything. It returns the order they would run in, as stages of installers
+// that may run in parallel. No names means the default set.
+func ValidatePlan(names []string) ([][]string, error) {
+    return InstanceOptions{Installers: names}.Plan()
+}
+
+// configValidator is implemented by installers that can check their options
+// before anything is created
+type configValidator interface {
+    validate() error
+}
+
+// Plan is like ValidatePlan for the installers selected by the options,
+// taking o.Configured into account, and also checks the options of each
+// installer. It returns no stages when o.SkipInstallers is set.
+func (o InstanceOptions) Plan() ([][]string, error) {
+    names := o.installerNames()
+    if len(names) == 0 {
+        return nil, nil
+    }
+
+    var unknown []string
+    installers := make([]SoftwareInstaller, 0, len(names))
+    for _, name := range names {
+        installer, ok := o.installer(name)
+        if !ok {
+            unknown = append(unknown, name)
+            continue
+        }
+        installers = append(installers, installer)
+    }
+    if len(unknown) > 0 {
+        return nil, fmt.Errorf("unknown installers %s, valid installers are: %s", strings.Join(unknown, ", "), strings.Join(RegisteredInstallers(), ", "))
+    }
+
+    var invalid []error
+    for _, installer := range installers {
+        if v, ok := installer.(configValidator); ok {
+            if err := v.validate(); err != nil {
+                invalid = append(invalid, err)
+            }
+        }
+    }
+    if err := errors.Join(invalid...); err != nil {
+        return nil, err
+    }
+
+    var missing []error
+    for _, installer := range installers {
+        for _, dep := range installer.DependsOn() {
+            if !slices.Contains(names, dep) {
+                missing = append(missing, fmt.Errorf("installer %s depends on %s, which is not selected", installer.Name(), dep))
+            }
+        }
+    }
+    if err := errors.Join(missing...); err != nil {
+        return nil, err
+    }
+
+    stages, err := planStages(installers)
+    if err != nil {
+        return nil, err
+    }
+    plan := make([][]string, len(stages))
+    for i, stage := range stages {
+        for _, installer := range stage {
+            plan[i] = append(plan[i], installer.Name())
+        }
+    }
+    return plan, nil
+}
+
+// planStages topologically sorts installers by their dependencies. Each stage
+// only depends on earlier stages; within a stage the input order is kept.
+func planStages(installers []SoftwareInstaller) ([][]SoftwareInstaller, error) {
+    indegree := make(map[string]int, len(installers))
+    for _, installer := range installers {
+        if _, ok := indegree[installer.Name()]; ok {
+            return nil, fmt.Errorf("installer %s is listed more than once", installer.Name())
+        }
+        indegree[installer.Name()] = 0
+    }
+
+    dependents := make(map[string][]string)
+    for _, installer := range installers {
+        for _, dep := range installer.DependsOn() {
+            if _, ok := indegree[dep]; !ok {
+                return nil, fmt.Errorf("installer %s depends on %s, which is not selected", installer.Name(), dep)
+            }
+            indegree[installer.Name()]++
+            dependents[dep] = append(dependents[dep], installer.Name())
+        }
+    }
+
+    var stages [][]SoftwareInstaller
+    remaining := installers
+    for len(remaining) > 0 {
+        var stage, rest []SoftwareInstaller
+        for _, installer := range remaining {
+            if indegree[installer.Name()] == 0 {
+                stage = append(stage, installer)
+            } else {
+                rest = append(rest, installer)
+            }
+        }
+
+        if len(stage) == 0 {
+            names := make([]string, len(rest))
+            for i, installer := range rest {
+                names[i] = installer.Name()
+            }
+            return nil, fmt.Errorf("installer dependencies form a cycle between %s", strings.Join(names, ", "))
+        }
+
+        for _, installer := range stage {
+            for _, name := range dependents[installer.Name()] {
+                indegree[name]--
+            }
+        }
+        stages = append(stages, stage)
+        remaining = rest
+    }
+    return stages, nil
+}
@@ -0,0 +1,247 @@
+package pkg
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+// scripted returns a ScriptInstaller named name that depends on deps and
+// installs by running "install <name>"
+func scripted(name string, deps ...string) ScriptInstaller {
+    return ScriptInstaller{InstallerName: name, InstallCommand: "install " + name, Requires: deps}
+}
+
+func TestPlanStages(t *testing.T) {
+    tests := []struct {
+        name       string
+        installers []SoftwareInstaller
+        want       [][]string
+        wantErr    string
+    }{
+        {
+            name:       "independent",
+            installers: []SoftwareInstaller{scripted("a"), scripted("b")},
+            want:       [][]string{{"a", "b"}},
+        },
+        {
+            name:       "chain listed backwards",
+            installers: []SoftwareInstaller{scripted("c", "b"), scripted("b", "a"), scripted("a")},
+            want:       [][]string{{"a"}, {"b"}, {"c"}},
+        },
+        {
+            name:       "diamond",
+            installers: []SoftwareInstaller{scripted("d", "b", "c"), scripted("b", "a"), scripted("c", "a"), scripted("a")},
+            want:       [][]string{{"a"}, {"b", "c"}, {"d"}},
+        },
+        {
+            name:       "missing dependency",
+            installers: []SoftwareInstaller{scripted("a", "b")},
+            wantErr:    "installer a depends on b, which is not selected",
+        },
+        {
+            name:       "cycle",
+            installers: []SoftwareInstaller{scripted("c"), scripted("a", "b"), scripted("b", "a")},
+            wantErr:    "installer dependencies form a cycle between a, b",
+        },
+        {
+            name:       "depends on itself",
+            installers: []SoftwareInstaller{scripted("a", "a")},
+            wantErr:    "installer dependencies form a cycle between a",
+        },
+        {
+            name:       "duplicate",
+            installers: []SoftwareInstaller{scripted("a"), scripted("a")},
+            wantErr:    "installer a is listed more than once",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            stages, err := planStages(tt.installers)
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("got error %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("planStages: %v", err)
+            }
+            got := make([][]string, len(stages))
+            for i, stage := range stages {
+                for _, installer := range stage {
+                    got[i] = append(got[i], installer.Name())
+                }
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("got stages %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRunInstallers(t *testing.T) {
+    failing := errors.New("exit status 1")
+    tests := []struct {
+        name       string
+        installers []SoftwareInstaller
+        // fail are the installers whose install script fails
+        fail            []string
+        continueOnError bool
+        wantErrs        []string
+        wantRan         []string
+        wantNotRan      []string
+    }{
+        {
+            name:       "fail fast stops later stages",
+            installers: []SoftwareInstaller{scripted("a"), scripted("b"), scripted("c", "b"), scripted("d")},
+            fail:       []string{"a"},
+            wantErrs:   []string{"error installing a"},
+            wantRan:    []string{"a", "b", "d"},
+            wantNotRan: []string{"c"},
+        },
+        {
+            name:       "fail fast joins failures in one stage",
+            installers: []SoftwareInstaller{scripted("a"), scripted("b"), scripted("c", "a")},
+            fail:       []string{"a", "b"},
+            wantErrs:   []string{"error installing a", "error installing b"},
+            wantRan:    []string{"a", "b"},
+            wantNotRan: []string{"c"},
+        },
+        {
+            name:            "continue on error",
+            installers:      []SoftwareInstaller{scripted("a"), scripted("b", "a"), scripted("c"), scripted("d", "c"), scripted("e"), scripted("f", "e")},
+            fail:            []string{"a", "c"},
+            continueOnError: true,
+            wantErrs:        []string{"error installing a", "skipped b: dependency a failed", "error installing c", "skipped d: dependency c failed"},
+            wantRan:         []string{"a", "c", "e", "f"},
+            wantNotRan:      []string{"b", "d"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            runner := &recordingRunner{errs: make(map[string]error)}
+            for _, name := range tt.fail {
+                runner.errs["install "+name] = failing
+            }
+            instance := InstanceDetails{Runner: runner, Output: io.Discard}
+            opts := InstanceOptions{MaxAttempts: 1, ContinueOnError: tt.continueOnError}
+
+            _, _, err := runInstallers(context.Background(), instance, tt.installers, opts)
+            if err == nil {
+                t.Fatal("runInstallers succeeded, want an error")
+            }
+            for _, want := range tt.wantErrs {
+                if !strings.Contains(err.Error(), want) {
+                    t.Errorf("error does not contain %q:\n%v", want, err)
+                }
+            }
+            var installerErr *InstallerError
+            if !errors.As(err, &installerErr) || !errors.Is(err, failing) {
+                t.Errorf("error does not wrap an InstallerError and the runner's error: %v", err)
+            }
+            for _, name := range tt.wantRan {
+                if !runner.ran("install " + name) {
+                    t.Errorf("%s was not installed", name)
+                }
+            }
+            for _, name := range tt.wantNotRan {
+                if runner.ran("install " + name) {
+                    t.Errorf("%s was installed", name)
+                }
+            }
+        })
+    }
+}
+
+func TestIsTransient(t *testing.T) {
+    commandErr := func(output string) error {
+        return fmt.Errorf("error installing x: %w", &CommandError{Output: output, Err: errors.New("exit status 100")})
+    }
+    type testCase struct {
+        name string
+        err  error
+        want bool
+    }
+    tests := []testCase{
+        {"plain error", errors.New("boom"), false},
+        {"command without a marker", commandErr("E: Sub-process /usr/bin/dpkg returned an error code (1)"), false},
+        {"network error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+        {"canceled", fmt.Errorf("install: %w", context.Canceled), false},
+        {"deadline exceeded", fmt.Errorf("install: %w", context.DeadlineExceeded), false},
+        {"permanent marker wins", commandErr("Failed to fetch http://archive.ubuntu.com\nE: Unable to locate package nope"), false},
+    }
+    for _, marker := range transientMarkers {
+        tests = append(tests, testCase{"transient " + marker, commandErr("E: " + marker + " something"), true})
+    }
+    for _, marker := range permanentMarkers {
+        tests = append(tests, testCase{"permanent " + marker, commandErr("E: Package nope " + marker), false})
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := isTransient(tt.err); got != tt.want {
+                t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRetryTransient(t *testing.T) {
+    orig := retryBackoff
+    retryBackoff = time.Millisecond
+    t.Cleanup(func() { retryBackoff = orig })
+
+    transient := &CommandError{Output: "Could not get lock /var/lib/dpkg/lock-frontend", Err: errors.New("exit status 100")}
+    permanent := &CommandError{Output: "E: Unable to locate package nope", Err: errors.New("exit status 100")}
+    tests := []struct {
+        name      string
+        attempts  int
+        errs      []error
+        wantCalls int
+        wantErr   error
+    }{
+        {"success", 3, nil, 1, nil},
+        {"transient then success", 3, []error{transient}, 2, nil},
+        {"transient until max attempts", 3, []error{transient, transient, transient, transient}, 3, transient},
+        {"single attempt", 1, []error{transient}, 1, transient},
+        {"permanent", 3, []error{permanent}, 1, permanent},
+        {"transient then permanent", 3, []error{transient, permanent}, 2, permanent},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            calls := 0
+            err := retryTransient(context.Background(), tt.attempts, func() error {
+                calls++
+                if calls <= len(tt.errs) {
+                    return tt.errs[calls-1]
+                }
+                return nil
+            })
+            if err != tt.wantErr {
+                t.Errorf("got error %v, want %v", err, tt.wantErr)
+            }
+            if calls != tt.wantCalls {
+                t.Errorf("called %d times, want %d", calls, tt.wantCalls)
+            }
+        })
+    }
+
+    t.Run("canceled", func(t *testing.T) {
+        ctx, cancel := context.WithCancel(context.Background())
+        cancel()
+        calls := 0
+        err := retryTransient(ctx, 3, func() error {
+            calls++
+            return transient
+        })
+        if err != transient || calls != 1 {
+            t.Errorf("got error %v after %d calls, want the first error without retrying", err, calls)
+        }
+    })
+}
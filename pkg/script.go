@@ -0,0 +1,132 @@
+package pkg
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+)
+
+// ScriptInstaller is an installer defined by shell commands rather than Go
+// code, typically loaded from a file with LoadScriptInstallers. Each command
+// runs on the instance like any other installer's script.
+type ScriptInstaller struct {
+    // InstallerName is the name the installer is registered and selected under
+    InstallerName string `json:"name"`
+    // InstallCommand installs the software. Required.
+    InstallCommand string `json:"install"`
+    // VerifyCommand exits zero if the software works. Empty skips verification.
+    VerifyCommand string `json:"verify,omitempty"`
+    // CheckCommand exits zero if the software is already installed. Empty
+    // always runs InstallCommand.
+    CheckCommand string `json:"check,omitempty"`
+    // UninstallCommand removes the software. Empty makes Uninstall fail.
+    UninstallCommand string `json:"uninstall,omitempty"`
+    // Requires lists the installers that must run first
+    Requires []string `json:"depends_on,omitempty"`
+}
+
+// Name returns the configured installer name
+func (s ScriptInstaller) Name() string { return s.InstallerName }
+
+// DependsOn returns the configured dependencies
+func (s ScriptInstaller) DependsOn() []string { return s.Requires }
+
+// IsInstalled runs CheckCommand, reporting false if there is none
+func (s ScriptInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    if s.CheckCommand == "" {
+        return false, nil
+    }
+    return probeRemoteCommand(ctx, instance, s.CheckCommand)
+}
+
+// Install runs InstallCommand
+func (s ScriptInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, s.InstallCommand)
+    return err
+}
+
+// Verify runs VerifyCommand if there is one
+func (s ScriptInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    if s.VerifyCommand == "" {
+        return nil
+    }
+    _, err := runRemoteCommand(ctx, instance, s.VerifyCommand)
+    return err
+}
+
+// Uninstall runs UninstallCommand
+func (s ScriptInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    if s.UninstallCommand == "" {
+        return fmt.Errorf("%s: no uninstall command configured", s.InstallerName)
+    }
+    _, err := runRemoteCommand(ctx, instance, s.UninstallCommand)
+    return err
+}
+
+// validate checks that the installer has a name and an install command
+func (s ScriptInstaller) validate() error {
+    if s.InstallerName == "" {
+        return errors.New("missing name")
+    }
+    if s.InstallCommand == "" {
+        return fmt.Errorf("%s: missing install command", s.InstallerName)
+    }
+    return nil
+}
+
+// LoadScriptInstallers reads a JSON array of ScriptInstaller definitions from
+// path, e.g.
+//
+//	[{"name": "nodejs", "install": "sudo apt-get install -y nodejs",
+//	  "verify": "node --version", "depends_on": ["docker"]}]
+//
+// Every definition must have a name and an install command.
+func LoadScriptInstallers(path string) ([]ScriptInstaller, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("error reading installer definitions: %w", err)
+    }
+    var installers []ScriptInstaller
+    if err := json.Unmarshal(data, &installers); err != nil {
+        return nil, fmt.Errorf("error parsing installer definitions %s: %w", path, err)
+    }
+
+    var errs []error
+    seen := make(map[string]bool)
+    for i, installer := range installers {
+        if err := installer.validate(); err != nil {
+            errs = append(errs, fmt.Errorf("installer %d: %w", i+1, err))
+            continue
+        }
+        if seen[installer.InstallerName] {
+            errs = append(errs, fmt.Errorf("installer %d: %s is defined twice", i+1, installer.InstallerName))
+        }
+        seen[installer.InstallerName] = true
+    }
+    if err := errors.Join(errs...); err != nil {
+        return nil, fmt.Errorf("invalid installer definitions %s: %w", path, err)
+    }
+    return installers, nil
+}
+
+// RegisterScriptInstallers loads the definitions in path with
+// LoadScriptInstallers and registers each one. Unlike RegisterInstaller it
+// returns an error rather than panicking if a name is already taken, and
+// registers nothing in that case.
+func RegisterScriptInstallers(path string) error {
+    installers, err := LoadScriptInstallers(path)
+    if err != nil {
+        return err
+    }
+    for _, installer := range installers {
+        if _, ok := LookupInstaller(installer.InstallerName); ok {
+            return fmt.Errorf("installer %s from %s is already registered", installer.InstallerName, path)
+        }
+    }
+    for _, installer := range installers {
+        RegisterInstaller(installer.InstallerName, installer)
+    }
+    return nil
+}
@@ -0,0 +1,276 @@
+package pkg
+
+import (
+    "context"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "golang.org/x/crypto/ssh"
+    "golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+    // maxSSHBackoff caps the delay between attempts in waitForSSH
+    maxSSHBackoff = 15 * time.Second
+    // commandErrorLines is how much output a CommandError message includes
+    commandErrorLines = 20
+)
+
+// dialSSH opens an SSH connection to the instance. It authenticates with the
+// private key first, falling back to the instance password if the key is
+// rejected or cannot be loaded.
+func dialSSH(ctx context.Context, instance InstanceDetails) (*ssh.Client, error) {
+    auth, keyErr := sshAuthMethods(instance)
+    if len(auth) == 0 {
+        return nil, keyErr
+    }
+
+    callback, err := hostKeyCallback(instance.KnownHostsFile)
+    if err != nil {
+        return nil, err
+    }
+
+    config := &ssh.ClientConfig{
+        User:            instance.sshUser(),
+        Auth:            auth,
+        HostKeyCallback: callback,
+        Timeout:         instance.sshConnectTimeout(),
+    }
+
+    addr := net.JoinHostPort(instance.PublicIP, strconv.Itoa(instance.sshPort()))
+    timeout := instance.sshConnectTimeout()
+    dialer := net.Dialer{Timeout: timeout}
+    conn, err := dialer.DialContext(ctx, "tcp", addr)
+    if err != nil {
+        if isTimeout(err) {
+            return nil, fmt.Errorf("%w: host %s did not answer within %s: %w", ErrSSHUnreachable, addr, timeout, err)
+        }
+        return nil, fmt.Errorf("%w: error connecting to %s: %w", ErrSSHUnreachable, addr, err)
+    }
+
+    // Bound the handshake too, so a host that accepts the connection but
+    // never answers cannot hang the run.
+    conn.SetDeadline(time.Now().Add(timeout))
+    c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+    if err != nil {
+        conn.Close()
+        if isTimeout(err) {
+            return nil, fmt.Errorf("%w: host %s did not complete the SSH handshake within %s: %w", ErrSSHUnreachable, addr, timeout, err)
+        }
+        return nil, fmt.Errorf("error establishing SSH connection to %s: %w", addr, errors.Join(keyErr, err))
+    }
+    conn.SetDeadline(time.Time{})
+    return ssh.NewClient(c, chans, reqs), nil
+}
+
+// sshAuthMethods returns the ways to log in to the instance, in the order to
+// try them: the private key, then the password. If the key cannot be loaded
+// it is left out and the error is returned alongside the other methods.
+func sshAuthMethods(instance InstanceDetails) ([]ssh.AuthMethod, error) {
+    var auth []ssh.AuthMethod
+    var keyErr error
+    if instance.SSHKey != "" || instance.Password == "" {
+        signer, err := loadSigner(instance.SSHKey, instance.SSHKeyPassphrase)
+        if err != nil {
+            keyErr = err
+        } else {
+            auth = append(auth, ssh.PublicKeys(signer))
+        }
+    }
+    if instance.Password != "" {
+        if keyErr != nil {
+            slog.Debug("SSH key unusable, falling back to password", "host", instance.PublicIP, "err", keyErr)
+        }
+        auth = append(auth, ssh.Password(instance.Password))
+    }
+    return auth, keyErr
+}
+
+// loadSigner reads and decodes the private key at path
+func loadSigner(path, passphrase string) (ssh.Signer, error) {
+    if path == "" {
+        return nil, errors.New("no SSH key given")
+    }
+    key, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("error reading SSH key %s: %w", path, err)
+    }
+
+    signer, err := parsePrivateKey(key, passphrase)
+    if err != nil {
+        return nil, fmt.Errorf("error parsing SSH key %s: %w", path, err)
+    }
+    return signer, nil
+}
+
+// parsePrivateKey decodes a private key, decrypting it with passphrase when one is given
+func parsePrivateKey(key []byte, passphrase string) (ssh.Signer, error) {
+    if passphrase == "" {
+        signer, err := ssh.ParsePrivateKey(key)
+        var missing *ssh.PassphraseMissingError
+        if errors.As(err, &missing) {
+            return nil, errors.New("key is encrypted, set SSHKeyPassphrase")
+        }
+        return signer, err
+    }
+
+    signer, err := ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+    if errors.Is(err, x509.IncorrectPasswordError) {
+        return nil, errors.New("incorrect passphrase")
+    }
+    return signer, err
+}
+
+// hostKeyCallback verifies host keys against knownHostsFile, or accepts any
+// host key when it is empty
+func hostKeyCallback(knownHostsFile string) (ssh.HostKeyCallback, error) {
+    if knownHostsFile == "" {
+        return ssh.InsecureIgnoreHostKey(), nil
+    }
+    callback, err := knownhosts.New(knownHostsFile)
+    if err != nil {
+        return nil, fmt.Errorf("error reading known hosts file %s: %w", knownHostsFile, err)
+    }
+    return callback, nil
+}
+
+// SSHReachable reports whether the instance accepts TCP connections on its
+// SSH port, trying once
+func SSHReachable(ctx context.Context, instance InstanceDetails) bool {
+    if instance.PublicIP == "" {
+        return false
+    }
+    dialer := net.Dialer{Timeout: instance.sshConnectTimeout()}
+    conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(instance.PublicIP, strconv.Itoa(instance.sshPort())))
+    if err != nil {
+        return false
+    }
+    conn.Close()
+    return true
+}
+
+// waitForSSH blocks until the instance accepts TCP connections on its SSH port,
+// retrying with exponential backoff until the context expires
+func waitForSSH(ctx context.Context, instance InstanceDetails) error {
+    addr := net.JoinHostPort(instance.PublicIP, strconv.Itoa(instance.sshPort()))
+    backoff := time.Second
+
+    dialer := net.Dialer{Timeout: instance.sshConnectTimeout()}
+    for {
+        conn, err := dialer.DialContext(ctx, "tcp", addr)
+        if err == nil {
+            conn.Close()
+            slog.Info("SSH is reachable", "addr", addr)
+            return nil
+        }
+        slog.Debug("SSH not reachable yet", "addr", addr, "err", err, "retry_in", backoff)
+
+        select {
+        case <-ctx.Done():
+            return fmt.Errorf("%w: %s did not accept connections: %w", ErrSSHUnreachable, addr, err)
+        case <-time.After(backoff):
+        }
+
+        if backoff < maxSSHBackoff {
+            backoff *= 2
+        }
+    }
+}
+
+// isTimeout reports whether err is a network operation timing out
+func isTimeout(err error) bool {
+    var netErr net.Error
+    return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// CommandError is returned when a remote command exits unsuccessfully.
+// Output holds everything the command wrote to stdout and stderr.
+type CommandError struct {
+    Output string
+    Err    error
+}
+
+func (e *CommandError) Error() string {
+    tail := lastLines(e.Output, commandErrorLines)
+    if tail == "" {
+        return e.Err.Error()
+    }
+    return fmt.Sprintf("%v, last output:\n%s", e.Err, tail)
+}
+
+func (e *CommandError) Unwrap() error {
+    return e.Err
+}
+
+// runRemoteCommand runs the given script on the instance over SSH, streaming
+// its stdout and stderr to the instance's output as they arrive, and returns
+// everything it wrote
+func runRemoteCommand(ctx context.Context, instance InstanceDetails, script string) (string, error) {
+    return execRemoteCommand(ctx, instance, script, "", instance.output())
+}
+
+// runRemoteCommandWithInput is like runRemoteCommand but feeds input to the
+// script's stdin. Installers hand secrets to their scripts this way: the
+// script reads them with read -r and passes them on only through builtins
+// such as printf or another command's stdin, never as arguments, where ps on
+// the instance would show them. Input is never printed in dry-run output.
+func runRemoteCommandWithInput(ctx context.Context, instance InstanceDetails, script, input string) (string, error) {
+    return execRemoteCommand(ctx, instance, script, input, instance.output())
+}
+
+// readRemoteCommand runs the given script on the instance over SSH without
+// streaming its output. Use it for probes and for commands that print secrets.
+func readRemoteCommand(ctx context.Context, instance InstanceDetails, script string) (string, error) {
+    return execRemoteCommand(ctx, instance, script, "", io.Discard)
+}
+
+// execRemoteCommand runs script on the instance with input on its stdin
+// through the instance's Runner, copying its combined output to stream
+func execRemoteCommand(ctx context.Context, instance InstanceDetails, script, input string, stream io.Writer) (string, error) {
+    return instance.runner().Run(ctx, instance, script, input, stream)
+}
+
+// lockedWriter serialises writes from the session's stdout and stderr copiers
+type lockedWriter struct {
+    mu sync.Mutex
+    w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.w.Write(p)
+}
+
+// probeRemoteCommand runs a check on the instance and reports whether it exited
+// zero. A non-zero exit status is an answer, not an error; failing to run the
+// check at all is.
+func probeRemoteCommand(ctx context.Context, instance InstanceDetails, script string) (bool, error) {
+    _, err := readRemoteCommand(ctx, instance, script)
+    var exitErr interface{ ExitStatus() int }
+    if errors.As(err, &exitErr) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return true, nil
+}
+
+// lastLines returns at most the last n lines of s
+func lastLines(s string, n int) string {
+    lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+    if len(lines) > n {
+        lines = lines[len(lines)-n:]
+    }
+    return strings.Join(lines, "\n")
+}
@@ -0,0 +1,105 @@
+package pkg
+
+import (
+    "bytes"
+    "context"
+    "crypto/ed25519"
+    "crypto/rand"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+
+    "github.com/civo/civogo"
+    "golang.org/x/crypto/ssh"
+)
+
+// GenerateSSHKey creates an ed25519 key pair, writes the private key to
+// privateKeyPath and registers the public key with Civo under name. It returns
+// the Civo SSH key ID to set as InstanceOptions.SSHKeyID.
+//
+// If Civo already has a key called name, its ID is returned as long as the
+// private key at privateKeyPath matches it; otherwise an error is returned and
+// nothing is changed. An existing file at privateKeyPath is never overwritten.
+func GenerateSSHKey(apiKey, regionCode, name, privateKeyPath string) (string, error) {
+    client, err := newCivoClient(context.Background(), apiKey, regionCode)
+    if err != nil {
+        return "", err
+    }
+
+    keys, err := client.ListSSHKeys()
+    if err != nil {
+        return "", fmt.Errorf("error listing SSH keys: %w", err)
+    }
+    for _, key := range keys {
+        if key.Name == name {
+            return existingSSHKey(key, privateKeyPath)
+        }
+    }
+
+    publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        return "", fmt.Errorf("error generating SSH key: %w", err)
+    }
+    block, err := ssh.MarshalPrivateKey(privateKey, name)
+    if err != nil {
+        return "", fmt.Errorf("error encoding SSH key: %w", err)
+    }
+    sshPublicKey, err := ssh.NewPublicKey(publicKey)
+    if err != nil {
+        return "", fmt.Errorf("error encoding SSH public key: %w", err)
+    }
+
+    if err := writePrivateKey(privateKeyPath, pem.EncodeToMemory(block)); err != nil {
+        return "", err
+    }
+
+    authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))) + " " + name
+    resp, err := client.NewSSHKey(name, authorizedKey)
+    if err != nil {
+        os.Remove(privateKeyPath)
+        return "", fmt.Errorf("error uploading SSH key %s: %w", name, err)
+    }
+    return resp.ID, nil
+}
+
+// existingSSHKey returns the ID of a key already registered with Civo if the
+// private key at privateKeyPath belongs to it
+func existingSSHKey(key civogo.SSHKey, privateKeyPath string) (string, error) {
+    pemBytes, err := os.ReadFile(privateKeyPath)
+    if errors.Is(err, os.ErrNotExist) {
+        return "", fmt.Errorf("an SSH key called %s already exists in Civo but %s does not exist; choose another name or delete the key", key.Name, privateKeyPath)
+    }
+    if err != nil {
+        return "", fmt.Errorf("error reading SSH key %s: %w", privateKeyPath, err)
+    }
+
+    signer, err := ssh.ParsePrivateKey(pemBytes)
+    if err != nil {
+        return "", fmt.Errorf("error parsing SSH key %s: %w", privateKeyPath, err)
+    }
+    registered, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.PublicKey))
+    if err != nil {
+        return "", fmt.Errorf("error parsing public key of Civo SSH key %s: %w", key.Name, err)
+    }
+    if !bytes.Equal(registered.Marshal(), signer.PublicKey().Marshal()) {
+        return "", fmt.Errorf("an SSH key called %s already exists in Civo and does not match %s", key.Name, privateKeyPath)
+    }
+    return key.ID, nil
+}
+
+// writePrivateKey writes a private key readable only by the current user,
+// refusing to replace an existing file
+func writePrivateKey(path string, key []byte) error {
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+    if err != nil {
+        return fmt.Errorf("error creating SSH key file %s: %w", path, err)
+    }
+    if _, err := f.Write(key); err != nil {
+        f.Close()
+        os.Remove(path)
+        return fmt.Errorf("error writing SSH key file %s: %w", path, err)
+    }
+    return f.Close()
+}
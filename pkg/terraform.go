@@ -0,0 +1,64 @@
+package pkg
+
+import (
+    "context"
+    "fmt"
+)
+
+// DefaultTerraformVersion is the Terraform release installed when none is set
+const DefaultTerraformVersion = "1.9.8"
+
+// TerraformInstaller installs the Terraform CLI from HashiCorp's release archive
+type TerraformInstaller struct {
+    // Version is the Terraform release, e.g. "1.9.8". Defaults to DefaultTerraformVersion.
+    Version string
+}
+
+// Name returns "terraform"
+func (t TerraformInstaller) Name() string { return "terraform" }
+
+// DependsOn returns no dependencies
+func (t TerraformInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the pinned Terraform version is on the PATH
+func (t TerraformInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, t.versionCheckScript())
+}
+
+// Install downloads the pinned Terraform release into /usr/local/bin
+func (t TerraformInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    version := t.version()
+    url := fmt.Sprintf("https://releases.hashicorp.com/terraform/%[1]s/terraform_%[1]s_linux_amd64.zip", version)
+    script := fmt.Sprintf(`sudo apt-get update &&
+sudo apt-get install -y unzip &&
+curl -fsSL -o /tmp/terraform.zip %s &&
+sudo unzip -o /tmp/terraform.zip terraform -d /usr/local/bin &&
+rm -f /tmp/terraform.zip`, shellQuote(url))
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that terraform runs and reports the pinned version
+func (t TerraformInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, t.versionCheckScript())
+    return err
+}
+
+// Uninstall removes the Terraform CLI from the instance
+func (t TerraformInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "sudo rm -f /usr/local/bin/terraform")
+    return err
+}
+
+// version returns the configured version or DefaultTerraformVersion
+func (t TerraformInstaller) version() string {
+    if t.Version == "" {
+        return DefaultTerraformVersion
+    }
+    return t.Version
+}
+
+// versionCheckScript succeeds if terraform reports the pinned version
+func (t TerraformInstaller) versionCheckScript() string {
+    return "terraform version | head -n 1 | grep -qxF " + shellQuote("Terraform v"+t.version())
+}
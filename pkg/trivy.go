@@ -0,0 +1,52 @@
+package pkg
+
+import (
+    "context"
+)
+
+// TrivyInstaller installs the Trivy security scanner from Aqua Security's apt repository
+type TrivyInstaller struct {
+    // UpdateDB downloads the vulnerability database after installing, so the
+    // first scan does not have to
+    UpdateDB bool
+}
+
+// Name returns "trivy"
+func (t TrivyInstaller) Name() string { return "trivy" }
+
+// DependsOn returns no dependencies
+func (t TrivyInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the trivy package is installed
+func (t TrivyInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, dpkgInstalledScript("trivy"))
+}
+
+// Install installs Trivy and optionally primes its vulnerability database
+func (t TrivyInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo apt-get update &&
+sudo apt-get install -y wget gnupg lsb-release &&
+wget -qO- https://aquasecurity.github.io/trivy-repo/deb/public.key | gpg --dearmor | sudo tee /usr/share/keyrings/trivy.gpg > /dev/null &&
+echo "deb [signed-by=/usr/share/keyrings/trivy.gpg] https://aquasecurity.github.io/trivy-repo/deb $(lsb_release -sc) main" | sudo tee /etc/apt/sources.list.d/trivy.list > /dev/null &&
+sudo apt-get update &&
+sudo apt-get install -y trivy`
+    if t.UpdateDB {
+        script += " &&\ntrivy image --download-db-only"
+    }
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that the trivy CLI runs
+func (t TrivyInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    _, err := runRemoteCommand(ctx, instance, "trivy --version")
+    return err
+}
+
+// Uninstall removes Trivy and its apt repository from the instance
+func (t TrivyInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo apt-get remove --purge -y trivy &&
+sudo rm -f /etc/apt/sources.list.d/trivy.list /usr/share/keyrings/trivy.gpg`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
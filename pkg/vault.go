@@ -0,0 +1,134 @@
+package pkg
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "strings"
+)
+
+// Defaults for the Vault server installed by VaultInstaller
+const (
+    DefaultVaultListenAddress = "127.0.0.1:8200"
+    DefaultVaultStoragePath   = "/opt/vault/data"
+)
+
+// vaultDevServiceUnit replaces the packaged unit in dev mode. %s is the listen address.
+const vaultDevServiceUnit = `[Unit]
+Description=HashiCorp Vault (dev mode)
+After=network.target
+
+[Service]
+User=vault
+ExecStart=/usr/bin/vault server -dev -dev-listen-address=%s
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target`
+
+// vaultConfig is the server configuration for file storage. The listener has
+// TLS disabled; put Vault behind a TLS terminating proxy before exposing it.
+const vaultConfig = `ui = true
+
+storage "file" {
+  path = %q
+}
+
+listener "tcp" {
+  address     = %q
+  tls_disable = 1
+}`
+
+// VaultInstaller installs HashiCorp Vault from HashiCorp's apt repository
+type VaultInstaller struct {
+    // DevMode runs an unsealed, in-memory dev server. Data is lost on restart,
+    // so use it only for experiments.
+    DevMode bool
+    // StoragePath is where the file storage backend keeps data. Defaults to
+    // DefaultVaultStoragePath. Ignored in dev mode.
+    StoragePath string
+    // ListenAddress is the host:port Vault listens on. Defaults to DefaultVaultListenAddress.
+    ListenAddress string
+}
+
+// Name returns "vault"
+func (v VaultInstaller) Name() string { return "vault" }
+
+// DependsOn returns no dependencies
+func (v VaultInstaller) DependsOn() []string { return nil }
+
+// IsInstalled reports whether the vault package is installed
+func (v VaultInstaller) IsInstalled(ctx context.Context, instance InstanceDetails) (bool, error) {
+    return probeRemoteCommand(ctx, instance, dpkgInstalledScript("vault"))
+}
+
+// Install installs Vault, writes its configuration and starts the service
+func (v VaultInstaller) Install(ctx context.Context, instance InstanceDetails) error {
+    addr := v.listenAddress()
+    if _, _, err := net.SplitHostPort(addr); err != nil {
+        return fmt.Errorf("vault: invalid listen address %q: %w", addr, err)
+    }
+
+    script := `sudo apt-get update &&
+sudo apt-get install -y gpg wget lsb-release &&
+wget -qO- https://apt.releases.hashicorp.com/gpg | gpg --dearmor | sudo tee /usr/share/keyrings/hashicorp-archive-keyring.gpg > /dev/null &&
+echo "deb [signed-by=/usr/share/keyrings/hashicorp-archive-keyring.gpg] https://apt.releases.hashicorp.com $(lsb_release -cs) main" | sudo tee /etc/apt/sources.list.d/hashicorp.list > /dev/null &&
+sudo apt-get update &&
+sudo apt-get install -y vault &&
+`
+    if v.DevMode {
+        script += writeFileScript("/etc/systemd/system/vault.service", fmt.Sprintf(vaultDevServiceUnit, addr)) + " &&\n"
+    } else {
+        path := v.storagePath()
+        script += fmt.Sprintf(`sudo mkdir -p %[1]s &&
+sudo chown -R vault:vault %[1]s &&
+%[2]s &&
+`, shellQuote(path), writeFileScript("/etc/vault.d/vault.hcl", fmt.Sprintf(vaultConfig, path, addr)))
+    }
+    script += "sudo systemctl daemon-reload && sudo systemctl enable vault && sudo systemctl restart vault"
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Verify checks that Vault answers vault status. A sealed server exits with
+// 2, which is expected before it has been initialised and unsealed.
+func (v VaultInstaller) Verify(ctx context.Context, instance InstanceDetails) error {
+    script := fmt.Sprintf("VAULT_ADDR=%s vault status; test $? -ne 1", shellQuote("http://"+v.clientAddress()))
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// Uninstall removes Vault and its apt repository. Data under StoragePath is kept.
+func (v VaultInstaller) Uninstall(ctx context.Context, instance InstanceDetails) error {
+    script := `sudo systemctl disable --now vault;
+sudo rm -f /etc/systemd/system/vault.service &&
+sudo apt-get remove --purge -y vault &&
+sudo rm -f /etc/apt/sources.list.d/hashicorp.list`
+    _, err := runRemoteCommand(ctx, instance, script)
+    return err
+}
+
+// listenAddress returns the configured address or DefaultVaultListenAddress
+func (v VaultInstaller) listenAddress() string {
+    if v.ListenAddress == "" {
+        return DefaultVaultListenAddress
+    }
+    return v.ListenAddress
+}
+
+// clientAddress returns the address to reach Vault at from the instance itself
+func (v VaultInstaller) clientAddress() string {
+    host, port, err := net.SplitHostPort(v.listenAddress())
+    if err != nil || host == "" || host == "0.0.0.0" || strings.Contains(host, ":") {
+        return net.JoinHostPort("127.0.0.1", port)
+    }
+    return net.JoinHostPort(host, port)
+}
+
+// storagePath returns the configured path or DefaultVaultStoragePath
+func (v VaultInstaller) storagePath() string {
+    if v.StoragePath == "" {
+        return DefaultVaultStoragePath
+    }
+    return v.StoragePath
+}